@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"op-sync/internal/openlistsync"
+)
+
+// jobState 为守护模式下单个 job 的运行状态，供控制接口读取和触发。
+type jobState struct {
+	name string
+	// trigger 缓冲为 1：运行中收到的多次 /run 合并为一次排队。
+	trigger chan struct{}
+
+	mu        sync.Mutex
+	paused    bool
+	running   bool
+	queued    bool
+	startedAt time.Time
+	progress  openlistsync.Progress
+	nextRun   time.Time
+	last      *lastRun
+}
+
+// lastRun 为上一次运行结果的摘要，不含逐文件明细。
+type lastRun struct {
+	StartedAt       time.Time                 `json:"started_at"`
+	FinishedAt      time.Time                 `json:"finished_at"`
+	DurationSeconds float64                   `json:"duration_seconds"`
+	Success         bool                      `json:"success"`
+	Error           string                    `json:"error,omitempty"`
+	Scan            openlistsync.ScanSummary  `json:"scan"`
+	Totals          openlistsync.ResultTotals `json:"totals"`
+}
+
+type jobStatus struct {
+	Job       string                 `json:"job"`
+	Phase     string                 `json:"phase"`
+	Paused    bool                   `json:"paused"`
+	Queued    bool                   `json:"queued"`
+	StartedAt *time.Time             `json:"started_at,omitempty"`
+	Progress  *openlistsync.Progress `json:"progress,omitempty"`
+	NextRun   *time.Time             `json:"next_run,omitempty"`
+	LastRun   *lastRun               `json:"last_run,omitempty"`
+}
+
+func newJobState(name string) *jobState {
+	return &jobState{name: name, trigger: make(chan struct{}, 1)}
+}
+
+// requestRun 请求立即运行；运行中时排队，返回 "started" 或 "queued"。
+func (s *jobState) requestRun() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+	if s.running {
+		s.queued = true
+		return "queued"
+	}
+	return "started"
+}
+
+func (s *jobState) setPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = paused
+}
+
+func (s *jobState) isPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+func (s *jobState) setNextRun(next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextRun = next
+}
+
+func (s *jobState) runStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = true
+	s.queued = false
+	s.startedAt = time.Now()
+	s.progress = openlistsync.Progress{}
+}
+
+func (s *jobState) setProgress(p openlistsync.Progress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress = p
+}
+
+func (s *jobState) runFinished(res *openlistsync.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+	if res != nil {
+		s.last = &lastRun{
+			StartedAt:       res.StartedAt,
+			FinishedAt:      res.FinishedAt,
+			DurationSeconds: res.DurationSeconds,
+			Success:         res.Success,
+			Error:           res.Error,
+			Scan:            res.Scan,
+			Totals:          res.Totals,
+		}
+	}
+}
+
+func (s *jobState) status() jobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := jobStatus{Job: s.name, Phase: "idle", Paused: s.paused, Queued: s.queued, LastRun: s.last}
+	if s.running {
+		startedAt, progress := s.startedAt, s.progress
+		st.Phase = "starting"
+		if progress.Phase != "" {
+			st.Phase = string(progress.Phase)
+		}
+		st.StartedAt = &startedAt
+		st.Progress = &progress
+	}
+	if !s.nextRun.IsZero() {
+		nextRun := s.nextRun
+		st.NextRun = &nextRun
+	}
+	return st
+}
+
+// controlServer 提供守护模式的 HTTP 控制接口：
+// POST /run、POST /pause、POST /resume 与 GET /status，均可用 ?job=<name> 只作用于单个 job。
+type controlServer struct {
+	token string
+	jobs  []*jobState
+}
+
+func (cs *controlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", cs.post(func(w http.ResponseWriter, jobs []*jobState) {
+		started := make(map[string]string, len(jobs))
+		for _, s := range jobs {
+			started[s.name] = s.requestRun()
+		}
+		writeJSON(w, http.StatusAccepted, map[string]any{"jobs": started})
+	}))
+	mux.HandleFunc("/pause", cs.post(func(w http.ResponseWriter, jobs []*jobState) {
+		for _, s := range jobs {
+			s.setPaused(true)
+		}
+		writeJSON(w, http.StatusOK, cs.statuses(jobs))
+	}))
+	mux.HandleFunc("/resume", cs.post(func(w http.ResponseWriter, jobs []*jobState) {
+		for _, s := range jobs {
+			s.setPaused(false)
+		}
+		writeJSON(w, http.StatusOK, cs.statuses(jobs))
+	}))
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		jobs, ok := cs.selectJobs(w, r)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, cs.statuses(jobs))
+	})
+	return cs.auth(mux)
+}
+
+func (cs *controlServer) post(h func(http.ResponseWriter, []*jobState)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		jobs, ok := cs.selectJobs(w, r)
+		if !ok {
+			return
+		}
+		h(w, jobs)
+	}
+}
+
+// selectJobs 按 ?job= 选择 job，未指定时返回全部。
+func (cs *controlServer) selectJobs(w http.ResponseWriter, r *http.Request) ([]*jobState, bool) {
+	name := strings.TrimSpace(r.URL.Query().Get("job"))
+	if name == "" {
+		return cs.jobs, true
+	}
+	for _, s := range cs.jobs {
+		if s.name == name {
+			return []*jobState{s}, true
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("job not found: %s", name))
+	return nil, false
+}
+
+func (cs *controlServer) statuses(jobs []*jobState) map[string]any {
+	out := make([]jobStatus, 0, len(jobs))
+	for _, s := range jobs {
+		out = append(out, s.status())
+	}
+	return map[string]any{"jobs": out}
+}
+
+// auth 在配置了 control_token 时要求 Authorization: Bearer <token>。
+func (cs *controlServer) auth(next http.Handler) http.Handler {
+	if cs.token == "" {
+		return next
+	}
+	want := []byte("Bearer " + cs.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// serveHTTP 在 addr 上监听并用 h 提供服务，监听失败时立即返回错误。
+func serveHTTP(name, addr string, h http.Handler) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s failed (%s): %w", name, addr, err)
+	}
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	return srv, nil
+}
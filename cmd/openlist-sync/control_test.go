@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"op-sync/internal/openlistsync"
+)
+
+func controlRequest(t *testing.T, h http.Handler, method, target, token string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s %s response %q: %v", method, target, rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func TestControlServerAuth(t *testing.T) {
+	cs := &controlServer{token: "secret", jobs: []*jobState{newJobState("default")}}
+	h := cs.handler()
+	if code, _ := controlRequest(t, h, http.MethodGet, "/status", ""); code != http.StatusUnauthorized {
+		t.Fatalf("status without token = %d, want 401", code)
+	}
+	if code, _ := controlRequest(t, h, http.MethodGet, "/status", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("status with wrong token = %d, want 401", code)
+	}
+	if code, _ := controlRequest(t, h, http.MethodGet, "/status", "secret"); code != http.StatusOK {
+		t.Fatalf("status with token = %d, want 200", code)
+	}
+}
+
+func TestControlServerRunQueuesWhenRunning(t *testing.T) {
+	movies, music := newJobState("movies"), newJobState("music")
+	h := (&controlServer{jobs: []*jobState{movies, music}}).handler()
+
+	movies.runStarted()
+	movies.setProgress(openlistsync.Progress{Phase: openlistsync.PhaseSubmitting, PlannedFiles: 4, ProcessedFiles: 1})
+	code, body := controlRequest(t, h, http.MethodPost, "/run", "")
+	if code != http.StatusAccepted {
+		t.Fatalf("run = %d, want 202", code)
+	}
+	jobs := body["jobs"].(map[string]any)
+	if jobs["movies"] != "queued" || jobs["music"] != "started" {
+		t.Fatalf("run response = %v, want movies queued and music started", jobs)
+	}
+	// 重复触发只排队一次。
+	controlRequest(t, h, http.MethodPost, "/run?job=movies", "")
+	if n := len(movies.trigger); n != 1 {
+		t.Fatalf("movies triggers = %d, want 1", n)
+	}
+
+	st := movies.status()
+	if st.Phase != "submitting" || !st.Queued || st.Progress.ProcessedFiles != 1 {
+		t.Fatalf("status = %+v, want submitting and queued", st)
+	}
+	movies.runFinished(&openlistsync.Result{Success: true, FinishedAt: time.Now()})
+	st = movies.status()
+	if st.Phase != "idle" || st.LastRun == nil || !st.LastRun.Success || st.Progress != nil {
+		t.Fatalf("status after finish = %+v, unexpected", st)
+	}
+}
+
+func TestControlServerPauseResume(t *testing.T) {
+	movies, music := newJobState("movies"), newJobState("music")
+	h := (&controlServer{jobs: []*jobState{movies, music}}).handler()
+
+	if code, _ := controlRequest(t, h, http.MethodPost, "/pause?job=movies", ""); code != http.StatusOK {
+		t.Fatalf("pause = %d, want 200", code)
+	}
+	if !movies.isPaused() || music.isPaused() {
+		t.Fatalf("paused = %v/%v, want only movies paused", movies.isPaused(), music.isPaused())
+	}
+	controlRequest(t, h, http.MethodPost, "/resume", "")
+	if movies.isPaused() {
+		t.Fatalf("movies still paused after resume")
+	}
+	if code, _ := controlRequest(t, h, http.MethodPost, "/pause?job=nope", ""); code != http.StatusNotFound {
+		t.Fatalf("pause unknown job = %d, want 404", code)
+	}
+	if code, _ := controlRequest(t, h, http.MethodGet, "/pause", ""); code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /pause = %d, want 405", code)
+	}
+}
@@ -3,14 +3,20 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"op-sync/internal/metrics"
+	"op-sync/internal/notify"
 	"op-sync/internal/openlistsync"
 )
 
@@ -18,37 +24,151 @@ type cliConfig struct {
 	configPath  string
 	baseURL     string
 	tokenFile   string
+	logLevelStr string
+	logLevel    openlistsync.LogLevel
+	logFormat   string
+	perPage     int
+	timeout     time.Duration
+	runOnStart  bool
+
+	scanConcurrency   int
+	submitConcurrency int
+	copyBatchSize     int
+	requestsPerSecond float64
+	taskRefresh       time.Duration
+	wait              bool
+	waitInterval      time.Duration
+	waitTimeout       time.Duration
+	taskRetries       int
+	taskRetryBackoff  time.Duration
+	maxRetries        int
+	retryBackoff      time.Duration
+	retryMaxBackoff   time.Duration
+	stateGrace        time.Duration
+
+	// username / password / passwdHash / otpSecret 用于自动登录和 token 续期。
+	username   string
+	password   string
+	passwdHash string
+	otpSecret  string
+
+	// metricsListen 非空时在守护模式下提供 /metrics；metrics 为运行时创建的指标汇总。
+	metricsListen string
+	metrics       *metrics.Registry
+	// controlListen 非空时在守护模式下提供 HTTP 控制接口，controlToken 非空时要求 Bearer 认证。
+	controlListen string
+	controlToken  string
+	// webhooks 为每次运行结束后按条件发送的通知。
+	webhooks []*notify.Webhook
+	// mailer 非空时按 mailOn 发送单次运行邮件；digestCrontab 非空时在守护模式下定期发送汇总邮件，
+	// digest 为运行时创建的汇总。
+	mailer        *notify.Mailer
+	mailOn        notify.Condition
+	digestCrontab string
+	digest        *notify.Digest
+
+	// jobConfig 为顶层（命令行 + 配置文件）给出的同步参数，同时作为各 job 的默认值。
+	jobConfig
+	rawJobs []jsonJob
+	jobs    []jobConfig
+}
+
+// jobConfig 描述一组独立的 src/dst 同步任务。
+type jobConfig struct {
+	name        string
 	srcDir      string
 	dstDir      string
 	outputDir   string
 	excludes    []string
+	includes    []string
 	minSizeDiff int64
-	logLevelStr string
-	logLevel    openlistsync.LogLevel
-	perPage     int
-	timeout     time.Duration
 	dryRun      bool
 	crontab     string
-	runOnStart  bool
+
+	minFileSize   int64
+	maxFileSize   int64
+	minAge        time.Duration
+	modifiedAfter time.Time
+	fileTypes     []string
+
+	overwritePolicy string
+	compare         string
+
+	mirror         bool
+	maxDelete      int
+	maxDeleteRatio float64
+
+	reportFile string
+	stateFile  string
 }
 
 const bytesPerKiB int64 = 1024
 
 type jsonConfig struct {
-	BaseURL           *string   `json:"base_url"`
-	TokenFile         *string   `json:"token_file"`
+	BaseURL    *string `json:"base_url"`
+	TokenFile  *string `json:"token_file"`
+	LogLevel   *string `json:"log_level"`
+	LogFormat  *string `json:"log_format"`
+	PerPage    *int    `json:"per_page"`
+	Timeout    *string `json:"timeout"`
+	RunOnStart *bool   `json:"run_on_start"`
+
+	ScanConcurrency   *int     `json:"scan_concurrency"`
+	SubmitConcurrency *int     `json:"submit_concurrency"`
+	CopyBatchSize     *int     `json:"copy_batch_size"`
+	RequestsPerSecond *float64 `json:"requests_per_second"`
+	TaskRefresh       *string  `json:"task_refresh_interval"`
+	Wait              *bool    `json:"wait"`
+	WaitInterval      *string  `json:"wait_interval"`
+	WaitTimeout       *string  `json:"wait_timeout"`
+	TaskRetries       *int     `json:"task_retries"`
+	TaskRetryBackoff  *string  `json:"task_retry_backoff"`
+	MaxRetries        *int     `json:"max_retries"`
+	RetryBackoff      *string  `json:"retry_backoff"`
+	RetryMaxBackoff   *string  `json:"retry_max_backoff"`
+	StateGrace        *string  `json:"state_grace"`
+	Username          *string  `json:"username"`
+	Password          *string  `json:"password"`
+	PasswdHash        *string  `json:"passwdhash"`
+	OTPSecret         *string  `json:"otp_secret"`
+	MetricsListen     *string  `json:"metrics_listen"`
+	ControlListen     *string  `json:"control_listen"`
+	ControlToken      *string  `json:"control_token"`
+	jsonJobOptions
+	Webhooks []jsonWebhook `json:"webhooks"`
+	SMTP     *jsonSMTP     `json:"smtp"`
+	Jobs     []jsonJob     `json:"jobs"`
+}
+
+// jsonJobOptions 为可在 job 内覆盖的字段，顶层取值作为默认值。
+type jsonJobOptions struct {
 	SrcDir            *string   `json:"src"`
 	DstDir            *string   `json:"dst"`
 	OutputDir         *string   `json:"output"`
 	Blacklist         *[]string `json:"blacklist"`
+	Include           *[]string `json:"include"`
 	MinSizeDiff       *int64    `json:"min_size_diff"`
 	SizeDiffThreshold *int64    `json:"size_diff_threshold"` // backward compatible (bytes)
-	LogLevel          *string   `json:"log_level"`
-	PerPage           *int      `json:"per_page"`
-	Timeout           *string   `json:"timeout"`
+	OverwritePolicy   *string   `json:"overwrite_policy"`
+	Compare           *string   `json:"compare"`
 	DryRun            *bool     `json:"dry_run"`
 	Crontab           *string   `json:"crontab"`
-	RunOnStart        *bool     `json:"run_on_start"`
+	Mirror            *bool     `json:"mirror"`
+	DeleteExtraneous  *bool     `json:"delete_extraneous"` // alias of mirror
+	MaxDelete         *int      `json:"max_delete"`
+	MaxDeleteRatio    *float64  `json:"max_delete_ratio"`
+	ReportFile        *string   `json:"report_file"`
+	StateFile         *string   `json:"state_file"`
+	MinFileSize       *string   `json:"min_file_size"`
+	MaxFileSize       *string   `json:"max_file_size"`
+	MinAge            *string   `json:"min_age"`
+	ModifiedAfter     *string   `json:"modified_after"`
+	FileTypes         *[]string `json:"file_types"`
+}
+
+type jsonJob struct {
+	Name *string `json:"name"`
+	jsonJobOptions
 }
 
 func defaultCLIConfig() cliConfig {
@@ -57,103 +177,378 @@ func defaultCLIConfig() cliConfig {
 		baseURL:     "http://localhost:35244",
 		tokenFile:   "token.txt",
 		logLevelStr: "info",
+		logFormat:   string(openlistsync.LogFormatText),
 		perPage:     openlistsync.DefaultPerPage,
 		timeout:     30 * time.Second,
 		runOnStart:  true,
+
+		scanConcurrency:   openlistsync.DefaultScanConcurrency,
+		submitConcurrency: openlistsync.DefaultSubmitConcurrency,
+		copyBatchSize:     openlistsync.DefaultCopyBatchSize,
+		taskRefresh:       openlistsync.DefaultTaskRefreshInterval,
+		waitInterval:      openlistsync.DefaultWaitInterval,
+		taskRetryBackoff:  openlistsync.DefaultTaskRetryBackoff,
+		maxRetries:        openlistsync.DefaultMaxRetries,
+		retryBackoff:      openlistsync.DefaultRetryBackoff,
+		retryMaxBackoff:   openlistsync.DefaultRetryMaxBackoff,
+		stateGrace:        openlistsync.DefaultStateGrace,
+		jobConfig: jobConfig{
+			maxDeleteRatio: openlistsync.DefaultMaxDeleteRatio,
+		},
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "login" {
+		if err := runLogin(os.Args[2:]); err != nil {
+			// login 子命令不读取 log_format，始终输出文本。
+			exitWithErr(errorLogger(openlistsync.LogFormatText), 1, "login failed", err)
+		}
+		return
+	}
+
 	cfg, err := parseFlags()
 	if err != nil {
-		exitWithErr(2, err)
+		// 参数或配置文件有误时 log_format 尚不可用，按文本输出。
+		exitWithErr(errorLogger(openlistsync.LogFormatText), 2, "invalid config", err)
 	}
+	errLogger := errorLogger(openlistsync.LogFormat(cfg.logFormat))
 
 	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	logger := openlistsync.NewLogger(os.Stdout, cfg.logLevel)
+	logger := openlistsync.NewLogger(os.Stdout, cfg.logLevel).WithFormat(openlistsync.LogFormat(cfg.logFormat))
 
-	if strings.TrimSpace(cfg.crontab) == "" {
-		runCfg, err := buildRunConfig(cfg, logger)
-		if err != nil {
-			exitWithErr(2, err)
+	if !cfg.hasSchedule() {
+		if cfg.metricsListen != "" || cfg.controlListen != "" || cfg.digestCrontab != "" {
+			logger.Info("metrics_listen, control_listen and smtp.digest_crontab are ignored without crontab")
 		}
-		if err := openlistsync.Run(runCtx, runCfg); err != nil {
-			exitWithErr(1, err)
+		var failed []string
+		for _, job := range cfg.jobs {
+			if err := runJobOnce(runCtx, cfg, job, nil, jobLogger(logger, job)); err != nil {
+				if len(cfg.jobs) == 1 {
+					exitWithErr(jobLogger(errLogger, job), 1, "run failed", err)
+				}
+				jobLogger(logger, job).Error("run failed", openlistsync.F("error", err))
+				failed = append(failed, job.name)
+			}
+		}
+		if len(failed) > 0 {
+			errLogger.Error("jobs failed", openlistsync.F("failed", len(failed)), openlistsync.F("total", len(cfg.jobs)), openlistsync.F("jobs", strings.Join(failed, ", ")))
+			os.Exit(1)
 		}
 		return
 	}
 
-	schedule, err := openlistsync.ParseCrontab(cfg.crontab)
-	if err != nil {
-		exitWithErr(2, fmt.Errorf("invalid -crontab: %w", err))
+	if cfg.metricsListen != "" {
+		cfg.metrics = metrics.New()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", cfg.metrics)
+		srv, err := serveHTTP("metrics_listen", cfg.metricsListen, mux)
+		if err != nil {
+			exitWithErr(errLogger, 1, "start metrics server failed", err)
+		}
+		logger.Info("metrics listening", openlistsync.F("addr", cfg.metricsListen), openlistsync.F("path", "/metrics"))
+		defer srv.Close()
 	}
-	logger.Infof("crontab mode enabled: %s", schedule.Expr())
 
-	runOnce := func() {
-		startAt := time.Now()
-		logger.Infof("scheduled run start: %s", startAt.Format(time.RFC3339))
-		runCfg, err := buildRunConfig(cfg, logger)
+	states := make([]*jobState, len(cfg.jobs))
+	for i, job := range cfg.jobs {
+		states[i] = newJobState(jobLabel(job))
+	}
+	if cfg.controlListen != "" {
+		cs := &controlServer{token: cfg.controlToken, jobs: states}
+		srv, err := serveHTTP("control_listen", cfg.controlListen, cs.handler())
 		if err != nil {
-			logger.Errorf("scheduled run skipped: %v", err)
-			return
+			exitWithErr(errLogger, 1, "start control api failed", err)
 		}
-		if err := openlistsync.Run(runCtx, runCfg); err != nil {
-			logger.Errorf("scheduled run failed: %v", err)
+		logger.Info("control api listening", openlistsync.F("addr", cfg.controlListen))
+		defer srv.Close()
+	}
+
+	// 每个 job 使用独立的调度循环；同一 job 内串行执行，不同 job 之间互不阻塞。
+	var wg sync.WaitGroup
+	if cfg.digestCrontab != "" {
+		cfg.digest = notify.NewDigest(time.Now())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runDigestLoop(runCtx, cfg, logger)
+		}()
+	}
+	for i, job := range cfg.jobs {
+		wg.Add(1)
+		go func(job jobConfig, state *jobState) {
+			defer wg.Done()
+			runJobLoop(runCtx, cfg, job, state, jobLogger(logger, job))
+		}(job, states[i])
+	}
+	wg.Wait()
+	logger.Info("received stop signal, exit")
+}
+
+// runJobLoop 按 job 自身的 crontab 持续执行，直到 ctx 结束。
+// 未配置 crontab 的 job 只在启动时执行一次；开启控制接口时仍可通过 /run 再次触发。
+// 暂停只跳过计划内的运行，/run 触发的运行照常执行。
+func runJobLoop(ctx context.Context, cfg cliConfig, job jobConfig, state *jobState, logger *openlistsync.Logger) {
+	runOnce := func(kind string) {
+		startAt := time.Now()
+		logger.Info("run start", openlistsync.F("kind", kind), openlistsync.F("start", startAt.Format(time.RFC3339)))
+		if err := runJobOnce(ctx, cfg, job, state, logger); err != nil {
+			logger.Error("run failed", openlistsync.F("kind", kind), openlistsync.F("error", err))
 		} else {
-			logger.Infof("scheduled run finished")
+			logger.Info("run finished", openlistsync.F("kind", kind), openlistsync.F("elapsed", time.Since(startAt)))
 		}
 	}
 
-	if cfg.runOnStart {
-		runOnce()
+	var schedule *openlistsync.CrontabSchedule
+	if job.crontab == "" {
+		logger.Info("crontab not set for this job, run once")
+		runOnce("scheduled")
+		if cfg.controlListen == "" {
+			return
+		}
 	} else {
-		logger.Infof("run_on_start disabled, skip immediate run")
-	}
-	for {
-		next, err := schedule.Next(time.Now())
+		var err error
+		schedule, err = openlistsync.ParseCrontab(job.crontab)
 		if err != nil {
-			exitWithErr(1, fmt.Errorf("calculate next schedule failed: %w", err))
+			logger.Error("invalid crontab, job disabled", openlistsync.F("crontab", job.crontab), openlistsync.F("error", err))
+			return
+		}
+		logger.Info("crontab mode enabled", openlistsync.F("crontab", schedule.Expr()))
+
+		if cfg.runOnStart {
+			runOnce("scheduled")
+		} else {
+			logger.Info("run_on_start disabled, skip immediate run")
 		}
-		wait := time.Until(next)
-		if wait < 0 {
-			wait = 0
+	}
+	for {
+		// 未配置 crontab 时 timerC 为 nil，只等待手动触发。
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		if schedule != nil {
+			next, err := schedule.Next(time.Now())
+			if err != nil {
+				logger.Error("calculate next schedule failed, job stopped", openlistsync.F("error", err))
+				return
+			}
+			wait := time.Until(next)
+			if wait < 0 {
+				wait = 0
+			}
+			logger.Info("next run", openlistsync.F("at", next.Format(time.RFC3339)))
+			state.setNextRun(next)
+			if cfg.metrics != nil {
+				cfg.metrics.SetNextRun(jobLabel(job), next)
+			}
+			timer = time.NewTimer(wait)
+			timerC = timer.C
 		}
-		logger.Infof("next run at: %s", next.Format(time.RFC3339))
 
-		timer := time.NewTimer(wait)
 		select {
-		case <-timer.C:
-			runOnce()
-		case <-runCtx.Done():
-			timer.Stop()
-			logger.Infof("received stop signal, exit")
+		case <-timerC:
+			if state.isPaused() {
+				logger.Info("job paused, skip scheduled run")
+				continue
+			}
+			runOnce("scheduled")
+		case <-state.trigger:
+			if timer != nil {
+				timer.Stop()
+			}
+			runOnce("manual")
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
 			return
 		}
 	}
 }
 
-func buildRunConfig(cfg cliConfig, logger *openlistsync.Logger) (openlistsync.Config, error) {
+// runJobOnce 执行一次同步；state 非空时（守护模式）记录运行状态与进度。
+func runJobOnce(ctx context.Context, cfg cliConfig, job jobConfig, state *jobState, logger *openlistsync.Logger) error {
+	runCfg, err := buildRunConfig(cfg, job, logger)
+	if err != nil {
+		notifyRun(ctx, cfg, job, failedResult(job, err), logger)
+		return err
+	}
+	if state != nil {
+		runCfg.Progress = state.setProgress
+		state.runStarted()
+	}
+	if cfg.metrics != nil {
+		cfg.metrics.RunStarted(jobLabel(job))
+	}
+	res, err := openlistsync.RunWithResult(ctx, runCfg)
+	if cfg.metrics != nil {
+		cfg.metrics.RunFinished(jobLabel(job), res, err)
+	}
+	if state != nil {
+		state.runFinished(res)
+	}
+	notifyRun(ctx, cfg, job, res, logger)
+	return err
+}
+
+// jobLabel 返回指标和控制接口中使用的 job 名称（单 job 模式下为 "default"）。
+func jobLabel(job jobConfig) string {
+	return expandJobName("{job}", job.name)
+}
+
+func jobLogger(logger *openlistsync.Logger, job jobConfig) *openlistsync.Logger {
+	return logger.WithJob(job.name)
+}
+
+// hasSchedule 报告是否有任一 job 配置了 crontab，决定是否以守护模式运行。
+func (cfg cliConfig) hasSchedule() bool {
+	for _, job := range cfg.jobs {
+		if job.crontab != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func buildRunConfig(cfg cliConfig, job jobConfig, logger *openlistsync.Logger) (openlistsync.Config, error) {
+	cred := cfg.credentials()
 	token, err := readToken(cfg.tokenFile)
 	if err != nil {
-		return openlistsync.Config{}, fmt.Errorf("read token failed: %w", err)
+		if !cred.Enabled() {
+			return openlistsync.Config{}, fmt.Errorf("read token failed: %w", err)
+		}
+		// 配置了账号时，没有可用 token 也可以运行：首次请求前会自动登录并写入 token 文件。
+		token = ""
 	}
 	return openlistsync.Config{
-		BaseURL:     cfg.baseURL,
-		Token:       token,
-		SrcDir:      cfg.srcDir,
-		DstDir:      cfg.dstDir,
-		OutputDir:   cfg.outputDir,
-		Blacklist:   cfg.excludes,
-		MinSizeDiff: cfg.minSizeDiff,
-		PerPage:     cfg.perPage,
-		Timeout:     cfg.timeout,
-		DryRun:      cfg.dryRun,
-		Logger:      logger,
+		Name:                job.name,
+		BaseURL:             cfg.baseURL,
+		Token:               token,
+		Credentials:         cred,
+		TokenFile:           cfg.tokenFile,
+		SrcDir:              job.srcDir,
+		DstDir:              job.dstDir,
+		OutputDir:           job.outputDir,
+		Blacklist:           job.excludes,
+		Include:             job.includes,
+		MinSizeDiff:         job.minSizeDiff,
+		MinFileSize:         job.minFileSize,
+		MaxFileSize:         job.maxFileSize,
+		MinAge:              job.minAge,
+		ModifiedAfter:       job.modifiedAfter,
+		FileTypes:           job.fileTypes,
+		OverwritePolicy:     openlistsync.OverwritePolicy(job.overwritePolicy),
+		Compare:             openlistsync.CompareMode(job.compare),
+		PerPage:             cfg.perPage,
+		ScanConcurrency:     cfg.scanConcurrency,
+		SubmitConcurrency:   cfg.submitConcurrency,
+		CopyBatchSize:       cfg.copyBatchSize,
+		TaskRefreshInterval: cfg.taskRefresh,
+		Wait:                cfg.wait,
+		WaitInterval:        cfg.waitInterval,
+		WaitTimeout:         cfg.waitTimeout,
+		TaskRetries:         cfg.taskRetries,
+		TaskRetryBackoff:    cfg.taskRetryBackoff,
+		RequestsPerSecond:   cfg.requestsPerSecond,
+		MaxRetries:          cfg.maxRetries,
+		RetryBackoff:        cfg.retryBackoff,
+		RetryMaxBackoff:     cfg.retryMaxBackoff,
+		Timeout:             cfg.timeout,
+		DryRun:              job.dryRun,
+		Mirror:              job.mirror,
+		MaxDelete:           job.maxDelete,
+		MaxDeleteRatio:      job.maxDeleteRatio,
+		ReportFile:          expandJobName(job.reportFile, job.name),
+		StateFile:           expandJobName(job.stateFile, job.name),
+		StateGrace:          cfg.stateGrace,
+		RequestObserver:     requestObserver(cfg.metrics),
+		Logger:              logger,
 	}, nil
 }
 
+// requestObserver 避免把 nil 的 *metrics.Registry 包装成非 nil 的接口值。
+func requestObserver(reg *metrics.Registry) openlistsync.RequestObserver {
+	if reg == nil {
+		return nil
+	}
+	return reg
+}
+
+// expandJobName 把路径中的 {job} 替换为 job 名称（单 job 模式下为 "default"）。
+func expandJobName(p, name string) string {
+	if name == "" {
+		name = "default"
+	}
+	return strings.ReplaceAll(p, "{job}", name)
+}
+
+func (cfg cliConfig) credentials() openlistsync.Credentials {
+	return openlistsync.Credentials{
+		Username:   strings.TrimSpace(cfg.username),
+		Password:   cfg.password,
+		PasswdHash: strings.TrimSpace(cfg.passwdHash),
+		OTPSecret:  strings.TrimSpace(cfg.otpSecret),
+	}
+}
+
+// runLogin 实现 login 子命令：登录 OpenList 并把 token 写入 token 文件。
+// 账号信息可以来自配置文件，也可以全部通过命令行传入（此时配置文件可以不存在）。
+func runLogin(args []string) error {
+	cfg := defaultCLIConfig()
+	configPath, err := detectConfigPath(args, cfg.configPath)
+	if err != nil {
+		return err
+	}
+	if err := loadJSONConfig(configPath, &cfg); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	var otpCode string
+	var printHash bool
+	fset := flag.NewFlagSet("login", flag.ExitOnError)
+	fset.StringVar(&cfg.configPath, "config", configPath, "path to JSON config file")
+	fset.StringVar(&cfg.baseURL, "base-url", cfg.baseURL, "OpenList base URL")
+	fset.StringVar(&cfg.tokenFile, "token-file", cfg.tokenFile, "write the new token to this file")
+	fset.StringVar(&cfg.username, "username", cfg.username, "OpenList username")
+	fset.StringVar(&cfg.password, "password", cfg.password, "OpenList password")
+	fset.StringVar(&cfg.passwdHash, "passwdhash", cfg.passwdHash, "OpenList password hash, instead of -password")
+	fset.StringVar(&cfg.otpSecret, "otp-secret", cfg.otpSecret, "base32 TOTP secret for two-factor authentication")
+	fset.StringVar(&otpCode, "otp-code", "", "one-time two-factor code, overrides -otp-secret")
+	fset.DurationVar(&cfg.timeout, "timeout", cfg.timeout, "HTTP timeout")
+	fset.BoolVar(&printHash, "print-passwdhash", false, "print passwdhash for -password and exit, without login")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	cred := cfg.credentials()
+	if printHash {
+		if cred.Password == "" {
+			return fmt.Errorf("-print-passwdhash requires -password")
+		}
+		fmt.Println(openlistsync.PasswdHash(cred.Password))
+		return nil
+	}
+	cred.OTPCode = strings.TrimSpace(otpCode)
+	if err := cred.Validate(); err != nil {
+		return err
+	}
+
+	logger := openlistsync.NewLogger(os.Stderr, openlistsync.LogLevelInfo)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	token, err := openlistsync.Login(ctx, cfg.baseURL, cred, cfg.timeout)
+	if err != nil {
+		return err
+	}
+	if err := openlistsync.WriteTokenFile(cfg.tokenFile, token); err != nil {
+		return fmt.Errorf("write token file failed: %w", err)
+	}
+	fmt.Println(token)
+	logger.Info("token written", openlistsync.F("path", cfg.tokenFile))
+	return nil
+}
+
 func parseFlags() (cliConfig, error) {
 	cfg := defaultCLIConfig()
 	detectedConfigPath, err := detectConfigPath(os.Args[1:], cfg.configPath)
@@ -167,6 +562,7 @@ func parseFlags() (cliConfig, error) {
 			return cliConfig{}, err
 		}
 	}
+	configExcludes, configIncludes := len(cfg.excludes), len(cfg.includes)
 
 	flag.StringVar(&cfg.configPath, "config", cfg.configPath, "path to JSON config file")
 	flag.StringVar(&cfg.baseURL, "base-url", cfg.baseURL, "OpenList base URL")
@@ -174,45 +570,299 @@ func parseFlags() (cliConfig, error) {
 	flag.StringVar(&cfg.srcDir, "src", cfg.srcDir, "source directory path in OpenList")
 	flag.StringVar(&cfg.dstDir, "dst", cfg.dstDir, "destination directory path in OpenList")
 	flag.StringVar(&cfg.outputDir, "output", cfg.outputDir, "actual copy destination path in OpenList (defaults to -dst)")
-	flag.Func("exclude", "blacklist wildcard pattern, repeatable or comma-separated", func(v string) error {
-		cfg.excludes = append(cfg.excludes, splitPatterns(v)...)
+	flag.Func("exclude", "blacklist wildcard pattern, repeatable or comma-separated; a re: entry takes the rest of the value", patternFlag(&cfg.excludes))
+	flag.Func("include", "include (whitelist) wildcard pattern, repeatable or comma-separated; a re: entry takes the rest of the value; -exclude takes precedence", patternFlag(&cfg.includes))
+	flag.Func("min-file-size", "skip source files smaller than this size, e.g. 1KiB", func(v string) (err error) {
+		cfg.minFileSize, err = openlistsync.ParseSize(v)
+		return err
+	})
+	flag.Func("max-file-size", "skip source files larger than this size, e.g. 20GiB", func(v string) (err error) {
+		cfg.maxFileSize, err = openlistsync.ParseSize(v)
+		return err
+	})
+	flag.DurationVar(&cfg.minAge, "min-age", cfg.minAge, "skip source files modified within this duration, e.g. 10m (still being written)")
+	flag.Func("modified-after", "skip source files modified before this date (YYYY-MM-DD or RFC 3339)", func(v string) (err error) {
+		cfg.modifiedAfter, err = parseDate(v)
+		return err
+	})
+	flag.Func("file-types", "only sync these file types, comma-separated: video, audio, text, image, unknown", func(v string) error {
+		cfg.fileTypes = splitPatterns(v)
 		return nil
 	})
 	flag.StringVar(&cfg.logLevelStr, "log-level", cfg.logLevelStr, "log level: debug, info, error")
+	flag.StringVar(&cfg.logFormat, "log-format", cfg.logFormat, "log format: text, json (one JSON object per line)")
 	flag.IntVar(&cfg.perPage, "per-page", cfg.perPage, "list API page size")
 	flag.Int64Var(&cfg.minSizeDiff, "min-size-diff", cfg.minSizeDiff, "copy only when src-dst size diff is >= this value (KiB)")
+	flag.StringVar(&cfg.overwritePolicy, "overwrite-policy", cfg.overwritePolicy, "overwrite rule for existing files: larger, newer, size-differs, newer-or-larger, always, never")
+	flag.StringVar(&cfg.compare, "compare", cfg.compare, "compare mode for existing files: size, hash (hash falls back to -overwrite-policy when unavailable)")
+	flag.IntVar(&cfg.scanConcurrency, "scan-concurrency", cfg.scanConcurrency, "number of directories listed concurrently while scanning")
+	flag.IntVar(&cfg.submitConcurrency, "submit-concurrency", cfg.submitConcurrency, "number of plan items submitted concurrently")
+	flag.IntVar(&cfg.copyBatchSize, "copy-batch-size", cfg.copyBatchSize, "max files per copy request, grouped by source and output directory")
+	flag.Float64Var(&cfg.requestsPerSecond, "requests-per-second", cfg.requestsPerSecond, "max OpenList API requests per second across all workers (0 = unlimited)")
+	flag.DurationVar(&cfg.taskRefresh, "task-refresh-interval", cfg.taskRefresh, "re-fetch undone copy tasks during a run at this interval (0 = once per run)")
+	flag.BoolVar(&cfg.wait, "wait", cfg.wait, "wait for submitted copy tasks to finish and fail the run if any task fails")
+	flag.DurationVar(&cfg.waitInterval, "wait-interval", cfg.waitInterval, "poll interval for -wait")
+	flag.DurationVar(&cfg.waitTimeout, "wait-timeout", cfg.waitTimeout, "max time to wait for copy tasks (0 = unlimited)")
+	flag.IntVar(&cfg.taskRetries, "task-retries", cfg.taskRetries, "retry copy tasks that fail inside OpenList up to this many times (implies -wait)")
+	flag.DurationVar(&cfg.taskRetryBackoff, "task-retry-backoff", cfg.taskRetryBackoff, "wait before the first task retry, doubled on each retry")
+	flag.IntVar(&cfg.maxRetries, "max-retries", cfg.maxRetries, "retries per API request on network errors, 5xx and 429 (copy requests only when not delivered)")
+	flag.DurationVar(&cfg.retryBackoff, "retry-backoff", cfg.retryBackoff, "initial wait before retrying an API request, grows exponentially with jitter")
+	flag.DurationVar(&cfg.retryMaxBackoff, "retry-max-backoff", cfg.retryMaxBackoff, "max wait between API request retries")
+	flag.StringVar(&cfg.username, "username", cfg.username, "OpenList username for automatic login when the token expires")
+	flag.StringVar(&cfg.password, "password", cfg.password, "OpenList password for automatic login")
+	flag.StringVar(&cfg.passwdHash, "passwdhash", cfg.passwdHash, "OpenList password hash for automatic login, instead of -password")
+	flag.StringVar(&cfg.otpSecret, "otp-secret", cfg.otpSecret, "base32 TOTP secret for automatic login with two-factor authentication")
 	flag.DurationVar(&cfg.timeout, "timeout", cfg.timeout, "HTTP timeout")
 	flag.BoolVar(&cfg.dryRun, "dry-run", cfg.dryRun, "plan only, do not submit copy")
 	flag.StringVar(&cfg.crontab, "crontab", cfg.crontab, "run continuously by cron expression (5 fields, e.g. */30 * * * *)")
+	flag.BoolVar(&cfg.mirror, "mirror", cfg.mirror, "delete target files and dirs that no longer exist in source")
+	flag.IntVar(&cfg.maxDelete, "max-delete", cfg.maxDelete, "mirror: refuse to run when more files than this would be deleted (0 = unlimited)")
+	flag.Float64Var(&cfg.maxDeleteRatio, "max-delete-ratio", cfg.maxDeleteRatio, "mirror: refuse to run when deleted/target files exceeds this ratio (0 = unlimited)")
+	flag.StringVar(&cfg.reportFile, "report-file", cfg.reportFile, "write a JSON run report to this file after each run ({job} is replaced by the job name)")
+	flag.StringVar(&cfg.metricsListen, "metrics-listen", cfg.metricsListen, "crontab mode: serve Prometheus metrics at http://<addr>/metrics (e.g. :9100)")
+	flag.StringVar(&cfg.controlListen, "control-listen", cfg.controlListen, "crontab mode: serve the HTTP control API (POST /run, /pause, /resume, GET /status) on this address (e.g. 127.0.0.1:9101)")
+	flag.StringVar(&cfg.controlToken, "control-token", cfg.controlToken, "bearer token required by the control API (empty = no auth)")
+	flag.StringVar(&cfg.stateFile, "state-file", cfg.stateFile, "remember submitted files in this JSON file to avoid resubmitting them ({job} is replaced by the job name)")
+	flag.DurationVar(&cfg.stateGrace, "state-grace", cfg.stateGrace, "with -state-file: do not resubmit a file within this time unless the source changed")
 	flag.BoolVar(&cfg.runOnStart, "run-on-start", cfg.runOnStart, "run once immediately when crontab mode starts")
 	flag.Parse()
 
-	cfg.srcDir = strings.TrimSpace(cfg.srcDir)
-	cfg.dstDir = strings.TrimSpace(cfg.dstDir)
-	cfg.outputDir = strings.TrimSpace(cfg.outputDir)
-	if cfg.srcDir == "" || cfg.dstDir == "" {
-		return cliConfig{}, fmt.Errorf("both -src and -dst are required")
-	}
 	if cfg.perPage < 0 {
 		return cliConfig{}, fmt.Errorf("-per-page must be >= 0")
 	}
-	if cfg.minSizeDiff < 0 {
-		return cliConfig{}, fmt.Errorf("-min-size-diff must be >= 0")
+	if cfg.scanConcurrency < 1 {
+		return cliConfig{}, fmt.Errorf("-scan-concurrency must be >= 1")
 	}
-	cfg.crontab = strings.TrimSpace(cfg.crontab)
-	if cfg.crontab != "" {
-		if _, err := openlistsync.ParseCrontab(cfg.crontab); err != nil {
-			return cliConfig{}, fmt.Errorf("invalid -crontab: %w", err)
-		}
+	if cfg.submitConcurrency < 1 {
+		return cliConfig{}, fmt.Errorf("-submit-concurrency must be >= 1")
+	}
+	if cfg.copyBatchSize < 1 {
+		return cliConfig{}, fmt.Errorf("-copy-batch-size must be >= 1")
+	}
+	if cfg.requestsPerSecond < 0 {
+		return cliConfig{}, fmt.Errorf("-requests-per-second must be >= 0")
 	}
+	if cfg.taskRefresh < 0 {
+		return cliConfig{}, fmt.Errorf("-task-refresh-interval must be >= 0")
+	}
+	if cfg.waitInterval <= 0 {
+		return cliConfig{}, fmt.Errorf("-wait-interval must be > 0")
+	}
+	if cfg.waitTimeout < 0 {
+		return cliConfig{}, fmt.Errorf("-wait-timeout must be >= 0")
+	}
+	if cfg.taskRetries < 0 {
+		return cliConfig{}, fmt.Errorf("-task-retries must be >= 0")
+	}
+	if cfg.taskRetryBackoff <= 0 {
+		return cliConfig{}, fmt.Errorf("-task-retry-backoff must be > 0")
+	}
+	if cfg.maxRetries < 0 {
+		return cliConfig{}, fmt.Errorf("-max-retries must be >= 0")
+	}
+	if cfg.retryBackoff <= 0 || cfg.retryMaxBackoff <= 0 {
+		return cliConfig{}, fmt.Errorf("-retry-backoff and -retry-max-backoff must be > 0")
+	}
+	if cfg.stateGrace <= 0 {
+		return cliConfig{}, fmt.Errorf("-state-grace must be > 0")
+	}
+	if err := cfg.credentials().Validate(); err != nil {
+		return cliConfig{}, err
+	}
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	jobs, err := resolveJobs(cfg, setFlags, cliPatterns{
+		excludes: cfg.excludes[configExcludes:],
+		includes: cfg.includes[configIncludes:],
+	})
+	if err != nil {
+		return cliConfig{}, err
+	}
+	cfg.jobs = jobs
 	lv, err := openlistsync.ParseLogLevel(cfg.logLevelStr)
 	if err != nil {
 		return cliConfig{}, err
 	}
 	cfg.logLevel = lv
+	format, err := openlistsync.ParseLogFormat(cfg.logFormat)
+	if err != nil {
+		return cliConfig{}, err
+	}
+	cfg.logFormat = string(format)
 	return cfg, nil
 }
 
+// cliPatterns 为命令行 -exclude / -include 追加的模式，配置了 jobs 时追加到每个 job 自己的列表之后。
+type cliPatterns struct {
+	excludes []string
+	includes []string
+}
+
+// resolveJobs 生成最终的 job 列表：
+// - 未配置 jobs 时，顶层参数即唯一的 job
+// - 配置了 jobs 时，job 内字段覆盖顶层默认值，命令行显式传入的参数再覆盖 job
+func resolveJobs(cfg cliConfig, setFlags map[string]bool, cli cliPatterns) ([]jobConfig, error) {
+	if len(cfg.rawJobs) == 0 {
+		job := cfg.jobConfig
+		job.name = ""
+		if err := validateJob(&job); err != nil {
+			return nil, err
+		}
+		return []jobConfig{job}, nil
+	}
+
+	jobs := make([]jobConfig, 0, len(cfg.rawJobs))
+	seen := make(map[string]struct{}, len(cfg.rawJobs))
+	// files 记录各 job 的报告与状态文件路径，不同 job 不能写同一个文件。
+	files := make(map[string]string)
+	for i, raw := range cfg.rawJobs {
+		job := cfg.jobConfig
+		job.excludes = append([]string(nil), cfg.excludes[:len(cfg.excludes)-len(cli.excludes)]...)
+		job.includes = append([]string(nil), cfg.includes[:len(cfg.includes)-len(cli.includes)]...)
+		job.name = fmt.Sprintf("job%d", i+1)
+		if raw.Name != nil && strings.TrimSpace(*raw.Name) != "" {
+			job.name = strings.TrimSpace(*raw.Name)
+		}
+		if _, ok := seen[job.name]; ok {
+			return nil, fmt.Errorf("duplicate job name: %s", job.name)
+		}
+		seen[job.name] = struct{}{}
+
+		if err := applyJobOptions(raw.jsonJobOptions, &job); err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.name, err)
+		}
+		applySetFlags(&job, cfg.jobConfig, setFlags, cli)
+
+		if err := validateJob(&job); err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.name, err)
+		}
+		for _, f := range []struct{ key, path string }{{"report_file", job.reportFile}, {"state_file", job.stateFile}} {
+			if f.path == "" {
+				continue
+			}
+			p := expandJobName(f.path, job.name)
+			if other, ok := files[p]; ok {
+				return nil, fmt.Errorf("job %s: %s %s is also used by job %s, use {job} in the path", job.name, f.key, p, other)
+			}
+			files[p] = job.name
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// applySetFlags 把命令行显式传入的 job 级参数覆盖到 job 上。
+func applySetFlags(job *jobConfig, top jobConfig, setFlags map[string]bool, cli cliPatterns) {
+	if setFlags["src"] {
+		job.srcDir = top.srcDir
+	}
+	if setFlags["dst"] {
+		job.dstDir = top.dstDir
+	}
+	if setFlags["output"] {
+		job.outputDir = top.outputDir
+	}
+	if setFlags["exclude"] {
+		job.excludes = append(job.excludes, cli.excludes...)
+	}
+	if setFlags["include"] {
+		job.includes = append(job.includes, cli.includes...)
+	}
+	if setFlags["min-size-diff"] {
+		job.minSizeDiff = top.minSizeDiff
+	}
+	if setFlags["min-file-size"] {
+		job.minFileSize = top.minFileSize
+	}
+	if setFlags["max-file-size"] {
+		job.maxFileSize = top.maxFileSize
+	}
+	if setFlags["min-age"] {
+		job.minAge = top.minAge
+	}
+	if setFlags["modified-after"] {
+		job.modifiedAfter = top.modifiedAfter
+	}
+	if setFlags["file-types"] {
+		job.fileTypes = top.fileTypes
+	}
+	if setFlags["overwrite-policy"] {
+		job.overwritePolicy = top.overwritePolicy
+	}
+	if setFlags["compare"] {
+		job.compare = top.compare
+	}
+	if setFlags["dry-run"] {
+		job.dryRun = top.dryRun
+	}
+	if setFlags["crontab"] {
+		job.crontab = top.crontab
+	}
+	if setFlags["mirror"] {
+		job.mirror = top.mirror
+	}
+	if setFlags["max-delete"] {
+		job.maxDelete = top.maxDelete
+	}
+	if setFlags["max-delete-ratio"] {
+		job.maxDeleteRatio = top.maxDeleteRatio
+	}
+	if setFlags["report-file"] {
+		job.reportFile = top.reportFile
+	}
+	if setFlags["state-file"] {
+		job.stateFile = top.stateFile
+	}
+}
+
+func validateJob(job *jobConfig) error {
+	job.srcDir = strings.TrimSpace(job.srcDir)
+	job.dstDir = strings.TrimSpace(job.dstDir)
+	job.outputDir = strings.TrimSpace(job.outputDir)
+	if job.srcDir == "" || job.dstDir == "" {
+		return fmt.Errorf("both -src and -dst are required")
+	}
+	if job.minSizeDiff < 0 {
+		return fmt.Errorf("-min-size-diff must be >= 0")
+	}
+	if job.maxFileSize > 0 && job.maxFileSize < job.minFileSize {
+		return fmt.Errorf("-max-file-size must be >= -min-file-size")
+	}
+	if job.minAge < 0 {
+		return fmt.Errorf("-min-age must be >= 0")
+	}
+	types, err := openlistsync.ParseFileTypes(job.fileTypes)
+	if err != nil {
+		return err
+	}
+	job.fileTypes = types
+	policy, err := openlistsync.ParseOverwritePolicy(job.overwritePolicy)
+	if err != nil {
+		return err
+	}
+	job.overwritePolicy = string(policy)
+	compare, err := openlistsync.ParseCompareMode(job.compare)
+	if err != nil {
+		return err
+	}
+	job.compare = string(compare)
+	if job.maxDelete < 0 {
+		return fmt.Errorf("-max-delete must be >= 0")
+	}
+	if job.maxDeleteRatio < 0 || job.maxDeleteRatio > 1 {
+		return fmt.Errorf("-max-delete-ratio must be between 0 and 1")
+	}
+	job.crontab = strings.TrimSpace(job.crontab)
+	if job.crontab != "" {
+		if _, err := openlistsync.ParseCrontab(job.crontab); err != nil {
+			return fmt.Errorf("invalid -crontab: %w", err)
+		}
+	}
+	return nil
+}
+
 func detectConfigPath(args []string, defaultPath string) (string, error) {
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
@@ -253,18 +903,31 @@ func hasHelpFlag(args []string) bool {
 	return false
 }
 
+// splitPatterns 按逗号拆分列表。正则中可能含有逗号（如 `re:\d{4,8}`），
+// 因此从以 re: 或 !re: 开头的一项起，剩余部分整体作为一个模式，不再拆分。
 func splitPatterns(v string) []string {
-	parts := strings.Split(v, ",")
-	out := make([]string, 0, len(parts))
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if part != "" {
+	var out []string
+	for v != "" {
+		part, rest, _ := strings.Cut(v, ",")
+		if strings.HasPrefix(strings.TrimPrefix(strings.TrimSpace(part), "!"), "re:") {
+			part, rest = v, ""
+		}
+		if part = strings.TrimSpace(part); part != "" {
 			out = append(out, part)
 		}
+		v = rest
 	}
 	return out
 }
 
+// patternFlag 返回 -exclude / -include 的解析函数，每次出现都追加到 dst。
+func patternFlag(dst *[]string) func(string) error {
+	return func(v string) error {
+		*dst = append(*dst, splitPatterns(v)...)
+		return nil
+	}
+}
+
 func loadJSONConfig(configPath string, cfg *cliConfig) error {
 	b, err := os.ReadFile(configPath)
 	if err != nil {
@@ -282,26 +945,12 @@ func loadJSONConfig(configPath string, cfg *cliConfig) error {
 	if jc.TokenFile != nil {
 		cfg.tokenFile = *jc.TokenFile
 	}
-	if jc.SrcDir != nil {
-		cfg.srcDir = *jc.SrcDir
-	}
-	if jc.DstDir != nil {
-		cfg.dstDir = *jc.DstDir
-	}
-	if jc.OutputDir != nil {
-		cfg.outputDir = *jc.OutputDir
-	}
-	if jc.Blacklist != nil {
-		cfg.excludes = append([]string(nil), *jc.Blacklist...)
-	}
-	if jc.MinSizeDiff != nil {
-		cfg.minSizeDiff = *jc.MinSizeDiff
-	} else if jc.SizeDiffThreshold != nil {
-		cfg.minSizeDiff = bytesToKiBCeil(*jc.SizeDiffThreshold)
-	}
 	if jc.LogLevel != nil {
 		cfg.logLevelStr = *jc.LogLevel
 	}
+	if jc.LogFormat != nil {
+		cfg.logFormat = *jc.LogFormat
+	}
 	if jc.PerPage != nil {
 		cfg.perPage = *jc.PerPage
 	}
@@ -312,18 +961,222 @@ func loadJSONConfig(configPath string, cfg *cliConfig) error {
 		}
 		cfg.timeout = d
 	}
-	if jc.DryRun != nil {
-		cfg.dryRun = *jc.DryRun
-	}
-	if jc.Crontab != nil {
-		cfg.crontab = strings.TrimSpace(*jc.Crontab)
-	}
 	if jc.RunOnStart != nil {
 		cfg.runOnStart = *jc.RunOnStart
 	}
+	if jc.MetricsListen != nil {
+		cfg.metricsListen = strings.TrimSpace(*jc.MetricsListen)
+	}
+	if jc.ControlListen != nil {
+		cfg.controlListen = strings.TrimSpace(*jc.ControlListen)
+	}
+	if jc.ControlToken != nil {
+		cfg.controlToken = strings.TrimSpace(*jc.ControlToken)
+	}
+	for i, jw := range jc.Webhooks {
+		w, err := jw.build()
+		if err != nil {
+			return fmt.Errorf("invalid webhooks[%d] in config file (%s): %w", i, configPath, err)
+		}
+		cfg.webhooks = append(cfg.webhooks, w)
+	}
+	if jc.SMTP != nil {
+		m, on, digest, err := jc.SMTP.build()
+		if err != nil {
+			return fmt.Errorf("invalid smtp in config file (%s): %w", configPath, err)
+		}
+		cfg.mailer, cfg.mailOn, cfg.digestCrontab = m, on, digest
+	}
+	if jc.ScanConcurrency != nil {
+		cfg.scanConcurrency = *jc.ScanConcurrency
+	}
+	if jc.SubmitConcurrency != nil {
+		cfg.submitConcurrency = *jc.SubmitConcurrency
+	}
+	if jc.CopyBatchSize != nil {
+		cfg.copyBatchSize = *jc.CopyBatchSize
+	}
+	if jc.RequestsPerSecond != nil {
+		cfg.requestsPerSecond = *jc.RequestsPerSecond
+	}
+	if jc.TaskRefresh != nil {
+		d, err := time.ParseDuration(strings.TrimSpace(*jc.TaskRefresh))
+		if err != nil {
+			return fmt.Errorf("invalid task_refresh_interval in config file (%s): %w", configPath, err)
+		}
+		cfg.taskRefresh = d
+	}
+	if jc.Wait != nil {
+		cfg.wait = *jc.Wait
+	}
+	if jc.WaitInterval != nil {
+		d, err := time.ParseDuration(strings.TrimSpace(*jc.WaitInterval))
+		if err != nil {
+			return fmt.Errorf("invalid wait_interval in config file (%s): %w", configPath, err)
+		}
+		cfg.waitInterval = d
+	}
+	if jc.WaitTimeout != nil {
+		d, err := time.ParseDuration(strings.TrimSpace(*jc.WaitTimeout))
+		if err != nil {
+			return fmt.Errorf("invalid wait_timeout in config file (%s): %w", configPath, err)
+		}
+		cfg.waitTimeout = d
+	}
+	if jc.TaskRetries != nil {
+		cfg.taskRetries = *jc.TaskRetries
+	}
+	if jc.TaskRetryBackoff != nil {
+		d, err := time.ParseDuration(strings.TrimSpace(*jc.TaskRetryBackoff))
+		if err != nil {
+			return fmt.Errorf("invalid task_retry_backoff in config file (%s): %w", configPath, err)
+		}
+		cfg.taskRetryBackoff = d
+	}
+	if jc.Username != nil {
+		cfg.username = *jc.Username
+	}
+	if jc.Password != nil {
+		cfg.password = *jc.Password
+	}
+	if jc.PasswdHash != nil {
+		cfg.passwdHash = *jc.PasswdHash
+	}
+	if jc.OTPSecret != nil {
+		cfg.otpSecret = *jc.OTPSecret
+	}
+	if jc.MaxRetries != nil {
+		cfg.maxRetries = *jc.MaxRetries
+	}
+	if jc.RetryBackoff != nil {
+		d, err := time.ParseDuration(strings.TrimSpace(*jc.RetryBackoff))
+		if err != nil {
+			return fmt.Errorf("invalid retry_backoff in config file (%s): %w", configPath, err)
+		}
+		cfg.retryBackoff = d
+	}
+	if jc.RetryMaxBackoff != nil {
+		d, err := time.ParseDuration(strings.TrimSpace(*jc.RetryMaxBackoff))
+		if err != nil {
+			return fmt.Errorf("invalid retry_max_backoff in config file (%s): %w", configPath, err)
+		}
+		cfg.retryMaxBackoff = d
+	}
+	if jc.StateGrace != nil {
+		d, err := time.ParseDuration(strings.TrimSpace(*jc.StateGrace))
+		if err != nil {
+			return fmt.Errorf("invalid state_grace in config file (%s): %w", configPath, err)
+		}
+		cfg.stateGrace = d
+	}
+	if err := applyJobOptions(jc.jsonJobOptions, &cfg.jobConfig); err != nil {
+		return fmt.Errorf("invalid config file (%s): %w", configPath, err)
+	}
+	cfg.rawJobs = jc.Jobs
 	return nil
 }
 
+// applyJobOptions 把配置文件中出现的 job 级字段写入 job。
+func applyJobOptions(o jsonJobOptions, job *jobConfig) error {
+	if o.SrcDir != nil {
+		job.srcDir = *o.SrcDir
+	}
+	if o.DstDir != nil {
+		job.dstDir = *o.DstDir
+	}
+	if o.OutputDir != nil {
+		job.outputDir = *o.OutputDir
+	}
+	if o.Blacklist != nil {
+		job.excludes = append([]string(nil), *o.Blacklist...)
+	}
+	if o.Include != nil {
+		job.includes = append([]string(nil), *o.Include...)
+	}
+	if o.MinSizeDiff != nil {
+		job.minSizeDiff = *o.MinSizeDiff
+	} else if o.SizeDiffThreshold != nil {
+		job.minSizeDiff = bytesToKiBCeil(*o.SizeDiffThreshold)
+	}
+	if o.OverwritePolicy != nil {
+		job.overwritePolicy = *o.OverwritePolicy
+	}
+	if o.Compare != nil {
+		job.compare = *o.Compare
+	}
+	if o.DryRun != nil {
+		job.dryRun = *o.DryRun
+	}
+	if o.Crontab != nil {
+		job.crontab = strings.TrimSpace(*o.Crontab)
+	}
+	if o.Mirror != nil {
+		job.mirror = *o.Mirror
+	} else if o.DeleteExtraneous != nil {
+		job.mirror = *o.DeleteExtraneous
+	}
+	if o.MaxDelete != nil {
+		job.maxDelete = *o.MaxDelete
+	}
+	if o.MaxDeleteRatio != nil {
+		job.maxDeleteRatio = *o.MaxDeleteRatio
+	}
+	if o.ReportFile != nil {
+		job.reportFile = strings.TrimSpace(*o.ReportFile)
+	}
+	if o.StateFile != nil {
+		job.stateFile = strings.TrimSpace(*o.StateFile)
+	}
+	if o.MinFileSize != nil {
+		v, err := openlistsync.ParseSize(*o.MinFileSize)
+		if err != nil {
+			return fmt.Errorf("invalid min_file_size: %w", err)
+		}
+		job.minFileSize = v
+	}
+	if o.MaxFileSize != nil {
+		v, err := openlistsync.ParseSize(*o.MaxFileSize)
+		if err != nil {
+			return fmt.Errorf("invalid max_file_size: %w", err)
+		}
+		job.maxFileSize = v
+	}
+	if o.MinAge != nil {
+		v, err := time.ParseDuration(strings.TrimSpace(*o.MinAge))
+		if err != nil {
+			return fmt.Errorf("invalid min_age: %w", err)
+		}
+		job.minAge = v
+	}
+	if o.ModifiedAfter != nil {
+		v, err := parseDate(*o.ModifiedAfter)
+		if err != nil {
+			return fmt.Errorf("invalid modified_after: %w", err)
+		}
+		job.modifiedAfter = v
+	}
+	if o.FileTypes != nil {
+		job.fileTypes = append([]string(nil), *o.FileTypes...)
+	}
+	return nil
+}
+
+// parseDate 解析 YYYY-MM-DD（本地时区零点）或 RFC 3339 时间，空字符串表示不限制。
+func parseDate(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, v, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("want YYYY-MM-DD or RFC 3339, got %q", v)
+	}
+	return t, nil
+}
+
 func bytesToKiBCeil(v int64) int64 {
 	if v <= 0 {
 		return 0
@@ -347,7 +1200,13 @@ func readToken(tokenFile string) (string, error) {
 	return token, nil
 }
 
-func exitWithErr(code int, err error) {
-	openlistsync.NewLogger(os.Stderr, openlistsync.LogLevelError).Errorf("%v", err)
+// errorLogger 返回输出到 stderr 的错误日志，格式与 log_format 一致。
+func errorLogger(format openlistsync.LogFormat) *openlistsync.Logger {
+	return openlistsync.NewLogger(os.Stderr, openlistsync.LogLevelError).WithFormat(format)
+}
+
+// exitWithErr 以结构化字段输出错误后退出，error 字段即为 err。
+func exitWithErr(logger *openlistsync.Logger, code int, msg string, err error) {
+	logger.Error(msg, openlistsync.F("error", err))
 	os.Exit(code)
 }
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"flag"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
+
+	"op-sync/internal/notify"
 )
 
 func TestLoadJSONConfigRunOnStartDefault(t *testing.T) {
@@ -24,6 +29,301 @@ func TestLoadJSONConfigRunOnStartOverride(t *testing.T) {
 	}
 }
 
+func TestResolveJobsLegacySingleJob(t *testing.T) {
+	cfg := defaultCLIConfig()
+	loadTestJSONConfig(t, `{"src": "/a", "dst": "/b", "blacklist": ["*.tmp"]}`, &cfg)
+
+	jobs, err := resolveJobs(cfg, nil, cliPatterns{})
+	if err != nil {
+		t.Fatalf("resolveJobs error: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("jobs length = %d, want 1", len(jobs))
+	}
+	if jobs[0].name != "" || jobs[0].srcDir != "/a" || jobs[0].dstDir != "/b" {
+		t.Fatalf("job = %+v, unexpected", jobs[0])
+	}
+}
+
+func TestResolveJobsInheritTopLevel(t *testing.T) {
+	cfg := defaultCLIConfig()
+	loadTestJSONConfig(t, `{
+		"dst": "/backup",
+		"blacklist": ["*.tmp"],
+		"crontab": "*/30 * * * *",
+		"jobs": [
+			{"name": "movies", "src": "/media/movies", "dst": "/backup/movies"},
+			{"src": "/media/music", "blacklist": ["*.log"], "dry_run": true, "crontab": ""}
+		]
+	}`, &cfg)
+
+	jobs, err := resolveJobs(cfg, nil, cliPatterns{})
+	if err != nil {
+		t.Fatalf("resolveJobs error: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("jobs length = %d, want 2", len(jobs))
+	}
+	movies := jobs[0]
+	if movies.name != "movies" || movies.dstDir != "/backup/movies" || movies.crontab != "*/30 * * * *" {
+		t.Fatalf("jobs[0] = %+v, unexpected", movies)
+	}
+	if len(movies.excludes) != 1 || movies.excludes[0] != "*.tmp" {
+		t.Fatalf("jobs[0].excludes = %v, want [*.tmp]", movies.excludes)
+	}
+	music := jobs[1]
+	if music.name != "job2" || music.dstDir != "/backup" || !music.dryRun || music.crontab != "" {
+		t.Fatalf("jobs[1] = %+v, unexpected", music)
+	}
+	if len(music.excludes) != 1 || music.excludes[0] != "*.log" {
+		t.Fatalf("jobs[1].excludes = %v, want [*.log]", music.excludes)
+	}
+}
+
+func TestResolveJobsFlagOverride(t *testing.T) {
+	cfg := defaultCLIConfig()
+	loadTestJSONConfig(t, `{"include": ["*.mkv"], "jobs": [{"name": "a", "src": "/a", "dst": "/b", "blacklist": ["*.tmp"]}]}`, &cfg)
+	cfg.dryRun = true
+	cfg.excludes = append(cfg.excludes, "*.log")
+	cfg.includes = append(cfg.includes, "*.mp4")
+
+	jobs, err := resolveJobs(cfg, map[string]bool{"dry-run": true, "exclude": true, "include": true}, cliPatterns{excludes: cfg.excludes, includes: []string{"*.mp4"}})
+	if err != nil {
+		t.Fatalf("resolveJobs error: %v", err)
+	}
+	if !jobs[0].dryRun {
+		t.Fatalf("dry_run = false, want true")
+	}
+	if len(jobs[0].excludes) != 2 || jobs[0].excludes[1] != "*.log" {
+		t.Fatalf("excludes = %v, want [*.tmp *.log]", jobs[0].excludes)
+	}
+	if len(jobs[0].includes) != 2 || jobs[0].includes[0] != "*.mkv" || jobs[0].includes[1] != "*.mp4" {
+		t.Fatalf("includes = %v, want [*.mkv *.mp4]", jobs[0].includes)
+	}
+}
+
+func TestResolveJobsDuplicateName(t *testing.T) {
+	cfg := defaultCLIConfig()
+	loadTestJSONConfig(t, `{"src": "/a", "dst": "/b", "jobs": [{"name": "x"}, {"name": "x"}]}`, &cfg)
+
+	if _, err := resolveJobs(cfg, nil, cliPatterns{}); err == nil {
+		t.Fatalf("expected duplicate job name error")
+	}
+}
+
+func TestBuildRunConfigPassesOptions(t *testing.T) {
+	cfg := defaultCLIConfig()
+	loadTestJSONConfig(t, `{"src": "/a", "dst": "/b", "overwrite_policy": "newer", "compare": "hash", "scan_concurrency": 3, "submit_concurrency": 2, "requests_per_second": 2.5, "copy_batch_size": 5, "task_refresh_interval": "45s", "wait": true, "wait_interval": "7s", "wait_timeout": "2h", "task_retries": 4, "task_retry_backoff": "90s", "max_retries": 1, "retry_backoff": "2s", "retry_max_backoff": "20s"}`, &cfg)
+	cfg.tokenFile = filepath.Join(t.TempDir(), "token.txt")
+	if err := os.WriteFile(cfg.tokenFile, []byte("tok\n"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	jobs, err := resolveJobs(cfg, nil, cliPatterns{})
+	if err != nil {
+		t.Fatalf("resolveJobs error: %v", err)
+	}
+
+	runCfg, err := buildRunConfig(cfg, jobs[0], nil)
+	if err != nil {
+		t.Fatalf("buildRunConfig error: %v", err)
+	}
+	if runCfg.Token != "tok" || runCfg.SrcDir != "/a" || runCfg.DstDir != "/b" {
+		t.Fatalf("run config = %+v, unexpected", runCfg)
+	}
+	if runCfg.OverwritePolicy != "newer" {
+		t.Fatalf("OverwritePolicy = %q, want newer", runCfg.OverwritePolicy)
+	}
+	if runCfg.Compare != "hash" {
+		t.Fatalf("Compare = %q, want hash", runCfg.Compare)
+	}
+	if runCfg.ScanConcurrency != 3 {
+		t.Fatalf("ScanConcurrency = %d, want 3", runCfg.ScanConcurrency)
+	}
+	if runCfg.SubmitConcurrency != 2 || runCfg.RequestsPerSecond != 2.5 {
+		t.Fatalf("SubmitConcurrency = %d, RequestsPerSecond = %v, want 2, 2.5", runCfg.SubmitConcurrency, runCfg.RequestsPerSecond)
+	}
+	if runCfg.CopyBatchSize != 5 {
+		t.Fatalf("CopyBatchSize = %d, want 5", runCfg.CopyBatchSize)
+	}
+	if runCfg.TaskRefreshInterval != 45*time.Second {
+		t.Fatalf("TaskRefreshInterval = %s, want 45s", runCfg.TaskRefreshInterval)
+	}
+	if !runCfg.Wait || runCfg.WaitInterval != 7*time.Second || runCfg.WaitTimeout != 2*time.Hour {
+		t.Fatalf("Wait = %v, WaitInterval = %s, WaitTimeout = %s, want true, 7s, 2h", runCfg.Wait, runCfg.WaitInterval, runCfg.WaitTimeout)
+	}
+	if runCfg.TaskRetries != 4 || runCfg.TaskRetryBackoff != 90*time.Second {
+		t.Fatalf("TaskRetries = %d, TaskRetryBackoff = %s, want 4, 90s", runCfg.TaskRetries, runCfg.TaskRetryBackoff)
+	}
+	if runCfg.MaxRetries != 1 || runCfg.RetryBackoff != 2*time.Second || runCfg.RetryMaxBackoff != 20*time.Second {
+		t.Fatalf("MaxRetries = %d, RetryBackoff = %s, RetryMaxBackoff = %s, want 1, 2s, 20s", runCfg.MaxRetries, runCfg.RetryBackoff, runCfg.RetryMaxBackoff)
+	}
+}
+
+func TestResolveJobsFileFilters(t *testing.T) {
+	cfg := defaultCLIConfig()
+	loadTestJSONConfig(t, `{
+		"max_file_size": "20GiB",
+		"min_file_size": "1KiB",
+		"jobs": [
+			{"name": "a", "src": "/a", "dst": "/b", "min_age": "10m", "modified_after": "2024-01-02", "file_types": ["Video", "audio"]},
+			{"name": "b", "src": "/c", "dst": "/d", "max_file_size": "0"}
+		]
+	}`, &cfg)
+
+	jobs, err := resolveJobs(cfg, nil, cliPatterns{})
+	if err != nil {
+		t.Fatalf("resolveJobs error: %v", err)
+	}
+	a, b := jobs[0], jobs[1]
+	if a.minFileSize != 1024 || a.maxFileSize != 20<<30 || a.minAge != 10*time.Minute {
+		t.Fatalf("job a = %+v, unexpected size/age filters", a)
+	}
+	if want := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local); !a.modifiedAfter.Equal(want) {
+		t.Fatalf("modified_after = %v, want %v", a.modifiedAfter, want)
+	}
+	if len(a.fileTypes) != 2 || a.fileTypes[0] != "video" {
+		t.Fatalf("file_types = %v, want [video audio]", a.fileTypes)
+	}
+	if b.maxFileSize != 0 || b.minFileSize != 1024 || b.minAge != 0 {
+		t.Fatalf("job b = %+v, want top-level min size and no max size", b)
+	}
+
+	cfg = defaultCLIConfig()
+	loadTestJSONConfig(t, `{"jobs": [{"src": "/a", "dst": "/b", "file_types": ["folder"]}]}`, &cfg)
+	if _, err := resolveJobs(cfg, nil, cliPatterns{}); err == nil {
+		t.Fatalf("expected invalid file type error")
+	}
+	cfg = defaultCLIConfig()
+	loadTestJSONConfig(t, `{"jobs": [{"src": "/a", "dst": "/b", "max_file_size": "20 parsecs"}]}`, &cfg)
+	if _, err := resolveJobs(cfg, nil, cliPatterns{}); err == nil {
+		t.Fatalf("expected invalid max_file_size error")
+	}
+}
+
+func TestPatternFlagKeepsRegexpCommas(t *testing.T) {
+	var excludes, includes []string
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Func("exclude", "", patternFlag(&excludes))
+	fs.Func("include", "", patternFlag(&includes))
+	err := fs.Parse([]string{
+		"-exclude", `*.tmp, re:^\d{4,8}\.nfo$`,
+		"-exclude", "a, ,b",
+		"-include", `!re:x{1,2},y`,
+	})
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+	if want := []string{"*.tmp", `re:^\d{4,8}\.nfo$`, "a", "b"}; !slices.Equal(excludes, want) {
+		t.Fatalf("excludes = %q, want %q", excludes, want)
+	}
+	if want := []string{"!re:x{1,2},y"}; !slices.Equal(includes, want) {
+		t.Fatalf("includes = %q, want %q", includes, want)
+	}
+}
+
+func TestBuildRunConfigWithoutTokenFile(t *testing.T) {
+	cfg := defaultCLIConfig()
+	loadTestJSONConfig(t, `{"src": "/a", "dst": "/b", "username": "admin", "password": "secret"}`, &cfg)
+	cfg.tokenFile = filepath.Join(t.TempDir(), "missing.txt")
+	jobs, err := resolveJobs(cfg, nil, cliPatterns{})
+	if err != nil {
+		t.Fatalf("resolveJobs error: %v", err)
+	}
+
+	runCfg, err := buildRunConfig(cfg, jobs[0], nil)
+	if err != nil {
+		t.Fatalf("buildRunConfig error: %v", err)
+	}
+	if runCfg.Token != "" || runCfg.Credentials.Username != "admin" || runCfg.TokenFile != cfg.tokenFile {
+		t.Fatalf("run config = %+v, want empty token with credentials", runCfg)
+	}
+
+	cfg.password = ""
+	if _, err := buildRunConfig(cfg, jobs[0], nil); err == nil {
+		t.Fatalf("expected read token error without credentials")
+	}
+}
+
+func TestResolveJobsReportFile(t *testing.T) {
+	cfg := defaultCLIConfig()
+	loadTestJSONConfig(t, `{"src": "/a", "dst": "/b", "report_file": "reports/{job}.json", "jobs": [{"name": "x"}, {"name": "y"}]}`, &cfg)
+
+	jobs, err := resolveJobs(cfg, nil, cliPatterns{})
+	if err != nil {
+		t.Fatalf("resolveJobs error: %v", err)
+	}
+	if got := expandJobName(jobs[1].reportFile, jobs[1].name); got != "reports/y.json" {
+		t.Fatalf("report file = %s, want reports/y.json", got)
+	}
+
+	cfg = defaultCLIConfig()
+	loadTestJSONConfig(t, `{"src": "/a", "dst": "/b", "report_file": "report.json", "jobs": [{"name": "x"}, {"name": "y"}]}`, &cfg)
+	if _, err := resolveJobs(cfg, nil, cliPatterns{}); err == nil {
+		t.Fatalf("expected error for shared report_file")
+	}
+}
+
+func TestResolveJobsStateFile(t *testing.T) {
+	cfg := defaultCLIConfig()
+	loadTestJSONConfig(t, `{"src": "/a", "dst": "/b", "state_file": "state/{job}.json", "state_grace": "2h", "jobs": [{"name": "x"}, {"name": "y", "state_file": "y.json"}]}`, &cfg)
+	jobs, err := resolveJobs(cfg, nil, cliPatterns{})
+	if err != nil {
+		t.Fatalf("resolveJobs error: %v", err)
+	}
+	cfg.tokenFile = filepath.Join(t.TempDir(), "token.txt")
+	if err := os.WriteFile(cfg.tokenFile, []byte("tok\n"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	runCfg, err := buildRunConfig(cfg, jobs[0], nil)
+	if err != nil {
+		t.Fatalf("buildRunConfig error: %v", err)
+	}
+	if runCfg.StateFile != "state/x.json" || runCfg.StateGrace != 2*time.Hour {
+		t.Fatalf("state_file = %s grace = %s, want state/x.json 2h", runCfg.StateFile, runCfg.StateGrace)
+	}
+	if jobs[1].stateFile != "y.json" {
+		t.Fatalf("job y state_file = %s, want y.json", jobs[1].stateFile)
+	}
+
+	cfg = defaultCLIConfig()
+	loadTestJSONConfig(t, `{"src": "/a", "dst": "/b", "state_file": "run.json", "jobs": [{"name": "x", "report_file": "run.json"}, {"name": "y", "state_file": "y.json"}]}`, &cfg)
+	if _, err := resolveJobs(cfg, nil, cliPatterns{}); err == nil {
+		t.Fatalf("expected error for report_file and state_file sharing a path")
+	}
+}
+
+func TestLoadJSONConfigWebhooks(t *testing.T) {
+	cfg := defaultCLIConfig()
+	loadTestJSONConfig(t, `{"webhooks": [{"url": "https://example.com/hook", "on": "changes", "timeout": "5s"}]}`, &cfg)
+	if len(cfg.webhooks) != 1 {
+		t.Fatalf("webhooks = %d, want 1", len(cfg.webhooks))
+	}
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"webhooks": [{"url": "https://example.com/hook", "body": "{{.Job"}]}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := loadJSONConfig(configPath, &cfg); err == nil {
+		t.Fatalf("expected error for invalid webhook body template")
+	}
+}
+
+func TestLoadJSONConfigSMTP(t *testing.T) {
+	cfg := defaultCLIConfig()
+	loadTestJSONConfig(t, `{"smtp": {"host": "smtp.example.com", "from": "bot@example.com", "to": ["ops@example.com"], "digest_crontab": "0 8 * * *"}}`, &cfg)
+	if cfg.mailer == nil || cfg.mailOn != notify.OnFailure || cfg.digestCrontab != "0 8 * * *" {
+		t.Fatalf("mailer=%v on=%q digest=%q, unexpected", cfg.mailer, cfg.mailOn, cfg.digestCrontab)
+	}
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"smtp": {"host": "smtp.example.com", "from": "bot@example.com", "to": ["ops@example.com"], "digest_crontab": "daily"}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := loadJSONConfig(configPath, &cfg); err == nil {
+		t.Fatalf("expected error for invalid digest_crontab")
+	}
+}
+
 func loadTestJSONConfig(t *testing.T, content string, cfg *cliConfig) {
 	t.Helper()
 
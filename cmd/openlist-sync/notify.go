@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"op-sync/internal/notify"
+	"op-sync/internal/openlistsync"
+)
+
+// jsonWebhook 为配置文件中 webhooks 数组的一项。
+type jsonWebhook struct {
+	URL          string            `json:"url"`
+	Method       string            `json:"method"`
+	Headers      map[string]string `json:"headers"`
+	Body         string            `json:"body"`
+	On           string            `json:"on"`
+	Timeout      *string           `json:"timeout"`
+	Retries      *int              `json:"retries"`
+	RetryBackoff *string           `json:"retry_backoff"`
+}
+
+// jsonSMTP 为配置文件中的 smtp 邮件通知配置。
+type jsonSMTP struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	StartTLS *bool    `json:"starttls"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Timeout  *string  `json:"timeout"`
+	// On 为单次运行邮件的发送条件，默认 failure。
+	On string `json:"on"`
+	// DigestCrontab 为每日摘要的发送时间（crontab 表达式），为空时不发送摘要。
+	DigestCrontab string `json:"digest_crontab"`
+}
+
+func (js jsonSMTP) build() (*notify.Mailer, notify.Condition, string, error) {
+	sc := notify.SMTPConfig{
+		Host:     js.Host,
+		Port:     js.Port,
+		StartTLS: true,
+		Username: js.Username,
+		Password: js.Password,
+		From:     js.From,
+		To:       js.To,
+	}
+	if js.StartTLS != nil {
+		sc.StartTLS = *js.StartTLS
+	}
+	if js.Timeout != nil {
+		d, err := time.ParseDuration(strings.TrimSpace(*js.Timeout))
+		if err != nil {
+			return nil, "", "", fmt.Errorf("invalid timeout: %w", err)
+		}
+		sc.Timeout = d
+	}
+	on, err := notify.ParseCondition(js.On)
+	if err != nil {
+		return nil, "", "", err
+	}
+	digest := strings.TrimSpace(js.DigestCrontab)
+	if digest != "" {
+		if _, err := openlistsync.ParseCrontab(digest); err != nil {
+			return nil, "", "", fmt.Errorf("invalid digest_crontab: %w", err)
+		}
+	}
+	m, err := notify.NewMailer(sc)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return m, on, digest, nil
+}
+
+func (jw jsonWebhook) build() (*notify.Webhook, error) {
+	wc := notify.WebhookConfig{
+		URL:     jw.URL,
+		Method:  jw.Method,
+		Headers: jw.Headers,
+		Body:    jw.Body,
+		On:      notify.Condition(jw.On),
+		Retries: notify.DefaultWebhookRetries,
+	}
+	if jw.Retries != nil {
+		wc.Retries = *jw.Retries
+	}
+	if jw.Timeout != nil {
+		d, err := time.ParseDuration(strings.TrimSpace(*jw.Timeout))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		wc.Timeout = d
+	}
+	if jw.RetryBackoff != nil {
+		d, err := time.ParseDuration(strings.TrimSpace(*jw.RetryBackoff))
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry_backoff: %w", err)
+		}
+		wc.RetryBackoff = d
+	}
+	return notify.NewWebhook(wc)
+}
+
+// notifyRun 按条件发送 webhook。通知失败只记录日志，不影响运行结果。
+func notifyRun(ctx context.Context, cfg cliConfig, job jobConfig, res *openlistsync.Result, logger *openlistsync.Logger) {
+	if len(cfg.webhooks) == 0 && cfg.mailer == nil {
+		return
+	}
+	r := *res
+	r.Job = jobLabel(job)
+	s := notify.NewSummary(&r)
+	// 收到停止信号时，被中断的这次运行也要通知出去。
+	ctx = context.WithoutCancel(ctx)
+	for _, w := range cfg.webhooks {
+		if !w.Matches(s) {
+			continue
+		}
+		if err := w.Send(ctx, s); err != nil {
+			logger.Error("webhook failed", openlistsync.F("webhook", w), openlistsync.F("error", err))
+			continue
+		}
+		logger.Debug("webhook sent", openlistsync.F("webhook", w))
+	}
+	if cfg.mailer != nil && cfg.mailOn.Match(s) {
+		subject, body := notify.RunMail(s)
+		if err := cfg.mailer.Send(ctx, subject, body); err != nil {
+			logger.Error("send mail failed", openlistsync.F("smtp", cfg.mailer), openlistsync.F("error", err))
+		} else {
+			logger.Debug("mail sent", openlistsync.F("subject", subject))
+		}
+	}
+	if cfg.digest != nil {
+		cfg.digest.Add(s)
+	}
+}
+
+// runDigestLoop 按 digest_crontab 发送汇总邮件，直到 ctx 结束。
+func runDigestLoop(ctx context.Context, cfg cliConfig, logger *openlistsync.Logger) {
+	schedule, err := openlistsync.ParseCrontab(cfg.digestCrontab)
+	if err != nil {
+		logger.Error("invalid digest_crontab, digest disabled", openlistsync.F("crontab", cfg.digestCrontab), openlistsync.F("error", err))
+		return
+	}
+	for {
+		next, err := schedule.Next(time.Now())
+		if err != nil {
+			logger.Error("calculate next digest time failed, digest disabled", openlistsync.F("error", err))
+			return
+		}
+		logger.Debug("next digest", openlistsync.F("at", next.Format(time.RFC3339)))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		subject, err := cfg.digest.Flush(time.Now(), func(subject, body string) error {
+			return cfg.mailer.Send(ctx, subject, body)
+		})
+		if err != nil {
+			logger.Error("send digest mail failed, runs kept for the next digest", openlistsync.F("smtp", cfg.mailer), openlistsync.F("error", err))
+			continue
+		}
+		logger.Info("digest mail sent", openlistsync.F("subject", subject))
+	}
+}
+
+// failedResult 为未能开始运行（如读取 token 失败）时用于通知的结果。
+func failedResult(job jobConfig, err error) *openlistsync.Result {
+	now := time.Now()
+	return &openlistsync.Result{Job: job.name, StartedAt: now, FinishedAt: now, Error: err.Error()}
+}
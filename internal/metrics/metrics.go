@@ -0,0 +1,217 @@
+// Package metrics 以 Prometheus 文本格式导出 op-sync 守护模式的运行指标。
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"op-sync/internal/openlistsync"
+)
+
+// requestBuckets 为 API 请求耗时直方图的桶上界（秒）。
+var requestBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry 汇总所有 job 的指标。零值不可用，使用 New 创建。
+type Registry struct {
+	mu         sync.Mutex
+	counters   map[string]*family
+	gauges     map[string]*family
+	histograms map[string]*histogramFamily
+}
+
+type family struct {
+	help   string
+	values map[string]float64
+}
+
+type histogramFamily struct {
+	help   string
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// New 创建空的 Registry。
+func New() *Registry {
+	return &Registry{
+		counters:   make(map[string]*family),
+		gauges:     make(map[string]*family),
+		histograms: make(map[string]*histogramFamily),
+	}
+}
+
+// RunStarted 记录一次运行开始。
+func (r *Registry) RunStarted(job string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(r.counters, "opsync_runs_started_total", "Sync runs started.", labels("job", job), 1)
+}
+
+// RunFinished 记录一次运行的结果；res 可能为部分结果。
+func (r *Registry) RunFinished(job string, res *openlistsync.Result, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l := labels("job", job)
+	if err == nil {
+		r.add(r.counters, "opsync_runs_succeeded_total", "Sync runs finished without error.", l, 1)
+	} else {
+		r.add(r.counters, "opsync_runs_failed_total", "Sync runs finished with an error.", l, 1)
+	}
+	if res == nil {
+		return
+	}
+	r.set(r.gauges, "opsync_last_run_timestamp_seconds", "Unix time when the last run finished.", l, float64(res.FinishedAt.UnixMilli())/1000)
+	r.set(r.gauges, "opsync_last_run_duration_seconds", "Duration of the last run.", l, res.DurationSeconds)
+	success := 0.0
+	if res.Success {
+		success = 1
+	}
+	r.set(r.gauges, "opsync_last_run_success", "Whether the last run succeeded (1) or failed (0).", l, success)
+
+	t := res.Totals
+	for _, v := range []struct {
+		outcome string
+		files   int
+		bytes   int64
+	}{
+		{"planned", t.PlannedFiles, t.PlannedBytes},
+		{"submitted", t.SubmittedFiles, t.SubmittedBytes},
+		{"duplicate", t.DuplicateFiles, t.DuplicateBytes},
+		{"failed", t.FailedFiles, t.FailedBytes},
+	} {
+		ol := labels("job", job, "outcome", v.outcome)
+		r.add(r.counters, "opsync_files_total", "Files in copy plans by outcome.", ol, float64(v.files))
+		r.add(r.counters, "opsync_bytes_total", "Bytes (source size) in copy plans by outcome.", ol, float64(v.bytes))
+	}
+}
+
+// SetNextRun 记录 job 下一次计划运行的时间。
+func (r *Registry) SetNextRun(job string, next time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(r.gauges, "opsync_next_run_timestamp_seconds", "Unix time of the next scheduled run.", labels("job", job), float64(next.Unix()))
+}
+
+// ObserveRequest 实现 openlistsync.RequestObserver，按接口和状态统计请求数与耗时。
+func (r *Registry) ObserveRequest(endpoint, status string, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l := labels("endpoint", endpoint, "status", status)
+	r.add(r.counters, "opsync_api_requests_total", "OpenList API requests by endpoint and status.", l, 1)
+
+	hf := r.histograms["opsync_api_request_duration_seconds"]
+	if hf == nil {
+		hf = &histogramFamily{help: "OpenList API request latency.", series: make(map[string]*histogram)}
+		r.histograms["opsync_api_request_duration_seconds"] = hf
+	}
+	h := hf.series[l]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(requestBuckets))}
+		hf.series[l] = h
+	}
+	sec := elapsed.Seconds()
+	for i, le := range requestBuckets {
+		if sec <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += sec
+	h.count++
+}
+
+// ServeHTTP 输出 Prometheus 文本格式（text/plain; version=0.0.4）。
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+// Write 把所有指标按名称排序后写出。
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	writeFamilies(w, r.counters, "counter")
+	writeFamilies(w, r.gauges, "gauge")
+	for _, name := range sortedKeys(r.histograms) {
+		hf := r.histograms[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, hf.help, name)
+		for _, l := range sortedKeys(hf.series) {
+			h := hf.series[l]
+			for i, le := range requestBuckets {
+				fmt.Fprintf(w, "%s_bucket{%s} %d\n", name, joinLabels(l, labels("le", formatFloat(le))), h.counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{%s} %d\n", name, joinLabels(l, labels("le", "+Inf")), h.count)
+			fmt.Fprintf(w, "%s_sum{%s} %s\n", name, l, formatFloat(h.sum))
+			fmt.Fprintf(w, "%s_count{%s} %d\n", name, l, h.count)
+		}
+	}
+}
+
+func (r *Registry) add(m map[string]*family, name, help, l string, v float64) {
+	f := familyOf(m, name, help)
+	f.values[l] += v
+}
+
+func (r *Registry) set(m map[string]*family, name, help, l string, v float64) {
+	f := familyOf(m, name, help)
+	f.values[l] = v
+}
+
+func familyOf(m map[string]*family, name, help string) *family {
+	f := m[name]
+	if f == nil {
+		f = &family{help: help, values: make(map[string]float64)}
+		m[name] = f
+	}
+	return f
+}
+
+func writeFamilies(w io.Writer, m map[string]*family, typ string) {
+	for _, name := range sortedKeys(m) {
+		f := m[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, typ)
+		for _, l := range sortedKeys(f.values) {
+			fmt.Fprintf(w, "%s{%s} %s\n", name, l, formatFloat(f.values[l]))
+		}
+	}
+}
+
+// labels 把 key/value 对编码为 Prometheus 标签串，如 job="a",outcome="failed"。
+func labels(kv ...string) string {
+	parts := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		parts = append(parts, kv[i]+`="`+labelEscaper.Replace(kv[i+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"op-sync/internal/openlistsync"
+)
+
+func TestRegistryExposition(t *testing.T) {
+	r := New()
+	r.RunStarted("photos")
+	r.RunFinished("photos", &openlistsync.Result{
+		FinishedAt:      time.Unix(1700000000, 0),
+		DurationSeconds: 12.5,
+		Success:         true,
+		Totals:          openlistsync.ResultTotals{PlannedFiles: 3, PlannedBytes: 300, SubmittedFiles: 2, SubmittedBytes: 200, FailedFiles: 1, FailedBytes: 100},
+	}, nil)
+	r.RunStarted("photos")
+	r.RunFinished("photos", nil, errors.New("boom"))
+	r.SetNextRun("photos", time.Unix(1700000600, 0))
+	r.ObserveRequest("/api/fs/list", "200", 300*time.Millisecond)
+	r.ObserveRequest("/api/fs/list", "200", 2*time.Second)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE opsync_runs_started_total counter",
+		`opsync_runs_started_total{job="photos"} 2`,
+		`opsync_runs_succeeded_total{job="photos"} 1`,
+		`opsync_runs_failed_total{job="photos"} 1`,
+		`opsync_last_run_timestamp_seconds{job="photos"} 1.7e+09`,
+		`opsync_last_run_duration_seconds{job="photos"} 12.5`,
+		`opsync_last_run_success{job="photos"} 1`,
+		`opsync_next_run_timestamp_seconds{job="photos"} 1.7000006e+09`,
+		`opsync_files_total{job="photos",outcome="submitted"} 2`,
+		`opsync_bytes_total{job="photos",outcome="failed"} 100`,
+		`opsync_api_requests_total{endpoint="/api/fs/list",status="200"} 2`,
+		"# TYPE opsync_api_request_duration_seconds histogram",
+		`opsync_api_request_duration_seconds_bucket{endpoint="/api/fs/list",status="200",le="0.25"} 0`,
+		`opsync_api_request_duration_seconds_bucket{endpoint="/api/fs/list",status="200",le="0.5"} 1`,
+		`opsync_api_request_duration_seconds_bucket{endpoint="/api/fs/list",status="200",le="+Inf"} 2`,
+		`opsync_api_request_duration_seconds_count{endpoint="/api/fs/list",status="200"} 2`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("content type = %q", ct)
+	}
+}
+
+func TestLabelsEscape(t *testing.T) {
+	got := labels("job", "a\"b\\c\nd")
+	want := `job="a\"b\\c\nd"`
+	if got != want {
+		t.Fatalf("labels = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,285 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"op-sync/internal/openlistsync"
+)
+
+const (
+	// maxMailFailures 为单封邮件中列出的失败项上限，其余只计数。
+	maxMailFailures = 50
+	// digestTopDirs 为摘要中按复制字节数列出的目录数。
+	digestTopDirs = 10
+)
+
+// RunMail 生成单次运行的通知邮件。
+func RunMail(s Summary) (subject, body string) {
+	status := "succeeded"
+	if !s.Success {
+		status = "failed"
+	}
+	subject = fmt.Sprintf("[op-sync] %s: run %s", s.Job, status)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Job:      %s\n", s.Job)
+	fmt.Fprintf(&b, "Started:  %s\n", s.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Duration: %s\n", time.Duration(s.DurationSeconds*float64(time.Second)).Round(time.Second))
+	fmt.Fprintf(&b, "Status:   %s\n", status)
+	if s.Error != "" {
+		fmt.Fprintf(&b, "Error:    %s\n", s.Error)
+	}
+	t := s.Totals
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "Planned:   %d files, %s\n", t.PlannedFiles, formatBytes(t.PlannedBytes))
+	fmt.Fprintf(&b, "Submitted: %d files, %s\n", t.SubmittedFiles, formatBytes(t.SubmittedBytes))
+	fmt.Fprintf(&b, "Duplicate: %d files\n", t.DuplicateFiles)
+	fmt.Fprintf(&b, "Failed:    %d files\n", t.FailedFiles+t.TaskFailedFiles)
+	if t.DeletedFiles > 0 || t.DeleteFailed > 0 {
+		fmt.Fprintf(&b, "Deleted:   %d files (%d failed)\n", t.DeletedFiles, t.DeleteFailed)
+	}
+
+	failures := itemFailures(s)
+	if len(failures) > 0 {
+		b.WriteString("\nFailures:\n")
+		writeFailures(&b, failures, 0)
+	}
+	return subject, b.String()
+}
+
+// itemFailures 列出提交失败、任务失败和删除失败的项。
+func itemFailures(s Summary) []string {
+	var out []string
+	for _, item := range s.Items {
+		switch {
+		case item.Outcome == openlistsync.ItemFailed:
+			out = append(out, fmt.Sprintf("%s: %s", item.RelPath, item.Error))
+		case item.Task != "" && item.Task != "succeeded":
+			out = append(out, fmt.Sprintf("%s: task %s %s", item.RelPath, item.Task, item.TaskError))
+		}
+	}
+	for _, item := range s.Deletes {
+		if item.Outcome == openlistsync.ItemFailed {
+			out = append(out, fmt.Sprintf("delete %s: %s", item.RelPath, item.Error))
+		}
+	}
+	return out
+}
+
+// writeFailures 最多写出 maxMailFailures 行，more 为此外已省略的条数。
+func writeFailures(b *strings.Builder, failures []string, more int) {
+	if len(failures) > maxMailFailures {
+		more += len(failures) - maxMailFailures
+		failures = failures[:maxMailFailures]
+	}
+	for _, f := range failures {
+		fmt.Fprintf(b, "  - %s\n", strings.TrimSpace(f))
+	}
+	if more > 0 {
+		fmt.Fprintf(b, "  ... and %d more\n", more)
+	}
+}
+
+// Digest 汇总上一次摘要之后的所有运行，并发安全。
+type Digest struct {
+	mu           sync.Mutex
+	since        time.Time
+	jobs         map[string]*digestJob
+	dirs         map[string]*digestDir
+	failures     []string
+	moreFailures int
+}
+
+type digestJob struct {
+	runs, failedRuns int
+	submittedFiles   int
+	submittedBytes   int64
+	failedFiles      int
+	deletedFiles     int
+}
+
+type digestDir struct {
+	files int
+	bytes int64
+}
+
+// NewDigest 创建从 now 开始统计的摘要。
+func NewDigest(now time.Time) *Digest {
+	d := &Digest{}
+	d.reset(now)
+	return d
+}
+
+func (d *Digest) reset(now time.Time) {
+	d.since = now
+	d.jobs = make(map[string]*digestJob)
+	d.dirs = make(map[string]*digestDir)
+	d.failures = nil
+	d.moreFailures = 0
+}
+
+// Add 计入一次运行。
+func (d *Digest) Add(s Summary) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	j := d.jobs[s.Job]
+	if j == nil {
+		j = &digestJob{}
+		d.jobs[s.Job] = j
+	}
+	j.runs++
+	t := s.Totals
+	j.submittedFiles += t.SubmittedFiles
+	j.submittedBytes += t.SubmittedBytes
+	j.failedFiles += t.FailedFiles + t.TaskFailedFiles
+	j.deletedFiles += t.DeletedFiles
+
+	for _, item := range s.Items {
+		if item.Outcome != openlistsync.ItemSubmitted {
+			continue
+		}
+		dir := d.dirs[item.DstDir]
+		if dir == nil {
+			dir = &digestDir{}
+			d.dirs[item.DstDir] = dir
+		}
+		dir.files++
+		dir.bytes += item.SrcSize
+	}
+
+	var failures []string
+	if !s.Success {
+		j.failedRuns++
+		failures = append(failures, fmt.Sprintf("%s run at %s failed: %s", s.Job, s.StartedAt.Format(time.RFC3339), s.Error))
+	}
+	for _, f := range itemFailures(s) {
+		failures = append(failures, s.Job+": "+f)
+	}
+	// 只保留最早的 maxMailFailures 条，避免长时间运行时占用过多内存。
+	for _, f := range failures {
+		if len(d.failures) < maxMailFailures {
+			d.failures = append(d.failures, f)
+		} else {
+			d.moreFailures++
+		}
+	}
+}
+
+// Flush 生成从上一次成功发送（或创建）到 now 的摘要邮件并交给 send 发送。
+// 发送期间新的运行计入下一次摘要；send 失败时本次摘要中的运行会并回统计，
+// 随下一次摘要一起发送，不会因为一次发送失败而丢失。
+func (d *Digest) Flush(now time.Time, send func(subject, body string) error) (subject string, err error) {
+	d.mu.Lock()
+	snap := &Digest{since: d.since, jobs: d.jobs, dirs: d.dirs, failures: d.failures, moreFailures: d.moreFailures}
+	d.reset(now)
+	d.mu.Unlock()
+
+	subject, body := snap.render(now)
+	if err := send(subject, body); err != nil {
+		d.mu.Lock()
+		d.merge(snap)
+		d.mu.Unlock()
+		return subject, err
+	}
+	return subject, nil
+}
+
+// merge 把较早的统计 old 并回 d，调用方需持有 d.mu。
+func (d *Digest) merge(old *Digest) {
+	d.since = old.since
+	for name, oj := range old.jobs {
+		j := d.jobs[name]
+		if j == nil {
+			d.jobs[name] = oj
+			continue
+		}
+		j.runs += oj.runs
+		j.failedRuns += oj.failedRuns
+		j.submittedFiles += oj.submittedFiles
+		j.submittedBytes += oj.submittedBytes
+		j.failedFiles += oj.failedFiles
+		j.deletedFiles += oj.deletedFiles
+	}
+	for name, od := range old.dirs {
+		dir := d.dirs[name]
+		if dir == nil {
+			d.dirs[name] = od
+			continue
+		}
+		dir.files += od.files
+		dir.bytes += od.bytes
+	}
+	// 与 Add 一致，只保留最早的 maxMailFailures 条。
+	failures := append(old.failures, d.failures...)
+	more := old.moreFailures + d.moreFailures
+	if len(failures) > maxMailFailures {
+		more += len(failures) - maxMailFailures
+		failures = failures[:maxMailFailures]
+	}
+	d.failures, d.moreFailures = failures, more
+}
+
+// render 生成从 d.since 到 now 的摘要邮件，调用方需保证 d 不被并发修改。
+func (d *Digest) render(now time.Time) (subject, body string) {
+	var runs, failedRuns, files int
+	var bytes int64
+	for _, j := range d.jobs {
+		runs += j.runs
+		failedRuns += j.failedRuns
+		files += j.submittedFiles
+		bytes += j.submittedBytes
+	}
+	subject = fmt.Sprintf("[op-sync] daily digest: %d runs, %d failed, %d files copied (%s)", runs, failedRuns, files, formatBytes(bytes))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Period: %s - %s\n", d.since.Format(time.RFC3339), now.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Runs: %d (%d failed)\n", runs, failedRuns)
+	fmt.Fprintf(&b, "Copied: %d files, %s\n", files, formatBytes(bytes))
+	if runs == 0 {
+		b.WriteString("\nNo runs in this period.\n")
+		return subject, b.String()
+	}
+
+	b.WriteString("\nJobs:\n")
+	for _, name := range sortedKeys(d.jobs) {
+		j := d.jobs[name]
+		fmt.Fprintf(&b, "  %s: %d runs (%d failed), copied %d files (%s), %d failed files",
+			name, j.runs, j.failedRuns, j.submittedFiles, formatBytes(j.submittedBytes), j.failedFiles)
+		if j.deletedFiles > 0 {
+			fmt.Fprintf(&b, ", deleted %d files", j.deletedFiles)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(d.dirs) > 0 {
+		dirs := sortedKeys(d.dirs)
+		sort.SliceStable(dirs, func(i, k int) bool { return d.dirs[dirs[i]].bytes > d.dirs[dirs[k]].bytes })
+		fmt.Fprintf(&b, "\nTop directories by bytes copied:\n")
+		for i, name := range dirs {
+			if i == digestTopDirs {
+				fmt.Fprintf(&b, "  ... and %d more\n", len(dirs)-digestTopDirs)
+				break
+			}
+			fmt.Fprintf(&b, "  %10s  %5d files  %s\n", formatBytes(d.dirs[name].bytes), d.dirs[name].files, name)
+		}
+	}
+
+	if len(d.failures) > 0 {
+		b.WriteString("\nFailures:\n")
+		writeFailures(&b, d.failures, d.moreFailures)
+	}
+	return subject, b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"op-sync/internal/openlistsync"
+)
+
+func TestRunMail(t *testing.T) {
+	subject, body := RunMail(failedSummary())
+	if subject != "[op-sync] movies: run failed" {
+		t.Fatalf("subject = %q", subject)
+	}
+	for _, want := range []string{`Error:    scan source failed: "boom"`, "Submitted: 2 files, 3.0 MiB", "  - b.mkv: storage busy"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("body missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestDigestFlush(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	d := NewDigest(start)
+	d.Add(NewSummary(&openlistsync.Result{
+		Job:     "movies",
+		Success: true,
+		Totals:  openlistsync.ResultTotals{SubmittedFiles: 3, SubmittedBytes: 3 << 30},
+		Items: []openlistsync.ItemResult{
+			{DstDir: "/backup/movies/a", SrcSize: 1 << 30, Outcome: openlistsync.ItemSubmitted},
+			{DstDir: "/backup/movies/b", SrcSize: 2 << 30, Outcome: openlistsync.ItemSubmitted},
+			{DstDir: "/backup/movies/a", SrcSize: 1 << 20, Outcome: openlistsync.ItemDuplicate},
+		},
+	}))
+	d.Add(NewSummary(&openlistsync.Result{
+		Job:       "music",
+		StartedAt: start.Add(time.Hour),
+		Error:     "sync finished with 1 failed items",
+		Totals:    openlistsync.ResultTotals{SubmittedFiles: 1, SubmittedBytes: 1 << 20, FailedFiles: 1},
+		Items: []openlistsync.ItemResult{
+			{RelPath: "x.flac", DstDir: "/backup/music", SrcSize: 1 << 20, Outcome: openlistsync.ItemSubmitted, Task: "failed", TaskError: "disk full"},
+			{RelPath: "y.flac", DstDir: "/backup/music", Outcome: openlistsync.ItemFailed, Error: "storage busy"},
+		},
+	}))
+
+	subject, body := flushDigest(t, d, start.Add(24*time.Hour))
+	if subject != "[op-sync] daily digest: 2 runs, 1 failed, 4 files copied (3.0 GiB)" {
+		t.Fatalf("subject = %q", subject)
+	}
+	b := strings.Index(body, "/backup/movies/b")
+	a := strings.Index(body, "/backup/movies/a")
+	if a < 0 || b < 0 || b > a {
+		t.Fatalf("top directories not sorted by bytes:\n%s", body)
+	}
+	for _, want := range []string{
+		"  movies: 1 runs (0 failed), copied 3 files (3.0 GiB), 0 failed files",
+		"music run at 2024-01-01T09:00:00Z failed: sync finished with 1 failed items",
+		"music: x.flac: task failed disk full",
+		"music: y.flac: storage busy",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("body missing %q:\n%s", want, body)
+		}
+	}
+
+	_, body = flushDigest(t, d, start.Add(48*time.Hour))
+	if !strings.Contains(body, "No runs in this period.") || !strings.Contains(body, "Period: 2024-01-02T08:00:00Z") {
+		t.Fatalf("digest not reset after flush:\n%s", body)
+	}
+}
+
+func TestDigestLimitsFailures(t *testing.T) {
+	d := NewDigest(time.Now())
+	for i := 0; i < maxMailFailures+5; i++ {
+		d.Add(NewSummary(&openlistsync.Result{Job: "j", Error: fmt.Sprintf("err %d", i)}))
+	}
+	_, body := flushDigest(t, d, time.Now())
+	if strings.Count(body, "\n  - ") != maxMailFailures || !strings.Contains(body, "... and 5 more") {
+		t.Fatalf("failures not limited:\n%s", body)
+	}
+}
+
+func TestDigestFlushKeepsRunsWhenSendFails(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	d := NewDigest(start)
+	d.Add(NewSummary(&openlistsync.Result{
+		Job:     "movies",
+		Success: true,
+		Totals:  openlistsync.ResultTotals{SubmittedFiles: 2, SubmittedBytes: 2 << 20},
+		Items:   []openlistsync.ItemResult{{DstDir: "/backup/movies", SrcSize: 2 << 20, Outcome: openlistsync.ItemSubmitted}},
+	}))
+	d.Add(NewSummary(&openlistsync.Result{Job: "music", StartedAt: start.Add(time.Hour), Error: "boom"}))
+
+	_, err := d.Flush(start.Add(24*time.Hour), func(subject, body string) error {
+		return errors.New("smtp: connection reset")
+	})
+	if err == nil {
+		t.Fatalf("Flush error = nil, want send error")
+	}
+	d.Add(NewSummary(&openlistsync.Result{Job: "movies", Success: true, Totals: openlistsync.ResultTotals{SubmittedFiles: 1, SubmittedBytes: 1 << 20}}))
+
+	subject, body := flushDigest(t, d, start.Add(48*time.Hour))
+	if subject != "[op-sync] daily digest: 3 runs, 1 failed, 3 files copied (3.0 MiB)" {
+		t.Fatalf("subject = %q", subject)
+	}
+	for _, want := range []string{
+		"Period: 2024-01-01T08:00:00Z",
+		"  movies: 2 runs (0 failed), copied 3 files (3.0 MiB)",
+		"music run at 2024-01-01T09:00:00Z failed: boom",
+		"/backup/movies",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("body missing %q:\n%s", want, body)
+		}
+	}
+}
+
+// flushDigest 调用 Flush 并返回发送的邮件内容。
+func flushDigest(t *testing.T, d *Digest, now time.Time) (subject, body string) {
+	t.Helper()
+	if _, err := d.Flush(now, func(s, b string) error {
+		subject, body = s, b
+		return nil
+	}); err != nil {
+		t.Fatalf("Flush error: %v", err)
+	}
+	return subject, body
+}
@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSMTPPort    = 587
+	DefaultSMTPTimeout = 30 * time.Second
+)
+
+// SMTPConfig 为发送邮件使用的 SMTP 服务器与收发件人。
+type SMTPConfig struct {
+	Host string
+	// Port 为 0 时使用 587。
+	Port int
+	// StartTLS 为 true 时要求服务器支持 STARTTLS 并在认证前升级为 TLS。
+	StartTLS bool
+	// Username 非空时使用 PLAIN 认证；net/smtp 只允许在 TLS 连接或 localhost 上发送密码。
+	Username string
+	Password string
+	From     string
+	To       []string
+	// Timeout 为整次发送（连接到发送完成）的超时，<= 0 时使用默认值。
+	Timeout time.Duration
+}
+
+// Mailer 通过 SMTP 发送纯文本邮件。
+type Mailer struct {
+	cfg  SMTPConfig
+	from *mail.Address
+	to   []*mail.Address
+}
+
+// NewMailer 校验配置并解析收发件人地址。
+func NewMailer(cfg SMTPConfig) (*Mailer, error) {
+	cfg.Host = strings.TrimSpace(cfg.Host)
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("smtp host is required")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = DefaultSMTPPort
+	}
+	if cfg.Port < 0 || cfg.Port > 65535 {
+		return nil, fmt.Errorf("invalid smtp port %d", cfg.Port)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultSMTPTimeout
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp from %q: %w", cfg.From, err)
+	}
+	if len(cfg.To) == 0 {
+		return nil, fmt.Errorf("smtp to is required")
+	}
+	m := &Mailer{cfg: cfg, from: from}
+	for _, v := range cfg.To {
+		addr, err := mail.ParseAddress(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid smtp to %q: %w", v, err)
+		}
+		m.to = append(m.to, addr)
+	}
+	return m, nil
+}
+
+// String 返回用于日志的服务器地址。
+func (m *Mailer) String() string {
+	return "smtp://" + m.addr()
+}
+
+func (m *Mailer) addr() string {
+	return net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+}
+
+// Send 发送一封纯文本邮件。
+func (m *Mailer) Send(ctx context.Context, subject, body string) error {
+	msg, err := m.message(subject, body, time.Now())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.addr())
+	if err != nil {
+		return fmt.Errorf("connect smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer c.Close()
+
+	if m.cfg.StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := c.Mail(m.from.Address); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	for _, to := range m.to {
+		if err := c.Rcpt(to.Address); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s: %w", to.Address, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("smtp write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp send message: %w", err)
+	}
+	return c.Quit()
+}
+
+// message 生成 UTF-8、quoted-printable 编码的邮件内容。
+func (m *Mailer) message(subject, body string, now time.Time) ([]byte, error) {
+	to := make([]string, 0, len(m.to))
+	for _, addr := range m.to {
+		to = append(to, addr.String())
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP 为测试用的本地 SMTP 服务，只实现发送一封邮件所需的命令。
+type fakeSMTP struct {
+	ln net.Listener
+
+	mu   sync.Mutex
+	auth string
+	from string
+	rcpt []string
+	data []byte
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeSMTP{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP fake")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		s.mu.Lock()
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+		case "AUTH":
+			s.auth = arg
+			_ = tp.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			s.from = arg
+			_ = tp.PrintfLine("250 OK")
+		case "RCPT":
+			s.rcpt = append(s.rcpt, arg)
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			s.mu.Unlock()
+			data, err := tp.ReadDotBytes()
+			s.mu.Lock()
+			if err != nil {
+				s.mu.Unlock()
+				return
+			}
+			s.data = data
+			_ = tp.PrintfLine("250 OK queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestMailerSend(t *testing.T) {
+	srv := newFakeSMTP(t)
+	m, err := NewMailer(SMTPConfig{
+		Host:     "127.0.0.1",
+		Port:     srv.port(),
+		Username: "bot",
+		Password: "secret",
+		From:     "op-sync <bot@example.com>",
+		To:       []string{"ops@example.com", "Boss <boss@example.com>"},
+		Timeout:  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewMailer error: %v", err)
+	}
+	body := "第一行\n.leading dot\n" + strings.Repeat("x", 100)
+	if err := m.Send(context.Background(), "同步失败 movies", body); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if want := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00bot\x00secret")); srv.auth != want {
+		t.Fatalf("auth = %q, want %q", srv.auth, want)
+	}
+	if srv.from != "FROM:<bot@example.com>" || strings.Join(srv.rcpt, ",") != "TO:<ops@example.com>,TO:<boss@example.com>" {
+		t.Fatalf("envelope from=%q rcpt=%v, unexpected", srv.from, srv.rcpt)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(srv.data)))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "同步失败 movies" {
+		t.Fatalf("subject = %q (%v)", subject, err)
+	}
+	got, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if strings.TrimSuffix(strings.ReplaceAll(string(got), "\r\n", "\n"), "\n") != body {
+		t.Fatalf("body = %q, want %q", got, body)
+	}
+}
+
+func TestMailerStartTLSRequired(t *testing.T) {
+	srv := newFakeSMTP(t)
+	m, err := NewMailer(SMTPConfig{Host: "127.0.0.1", Port: srv.port(), StartTLS: true, From: "bot@example.com", To: []string{"ops@example.com"}})
+	if err != nil {
+		t.Fatalf("NewMailer error: %v", err)
+	}
+	if err := m.Send(context.Background(), "s", "b"); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Send error = %v, want STARTTLS not supported", err)
+	}
+}
+
+func TestNewMailerInvalid(t *testing.T) {
+	for _, sc := range []SMTPConfig{
+		{From: "bot@example.com", To: []string{"ops@example.com"}},
+		{Host: "smtp.example.com", From: "not an address", To: []string{"ops@example.com"}},
+		{Host: "smtp.example.com", From: "bot@example.com"},
+		{Host: "smtp.example.com", Port: 70000, From: "bot@example.com", To: []string{"ops@example.com"}},
+	} {
+		if _, err := NewMailer(sc); err == nil {
+			t.Fatalf("NewMailer(%+v) = nil error, want error", sc)
+		}
+	}
+}
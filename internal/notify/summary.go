@@ -0,0 +1,96 @@
+// Package notify 在每次运行结束后按条件发送通知（webhook 等）。
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"op-sync/internal/openlistsync"
+)
+
+// Condition 为发送通知的条件。
+type Condition string
+
+const (
+	// OnFailure 只在运行失败时发送。
+	OnFailure Condition = "failure"
+	// OnChanges 在运行失败，或提交了复制、删除了文件时发送。
+	OnChanges Condition = "changes"
+	OnAlways  Condition = "always"
+	// OnNever 不发送，用于只需要每日摘要的邮件通知。
+	OnNever Condition = "never"
+)
+
+// ParseCondition 解析通知条件，空字符串视为 failure。
+func ParseCondition(v string) (Condition, error) {
+	switch c := Condition(strings.ToLower(strings.TrimSpace(v))); c {
+	case "":
+		return OnFailure, nil
+	case OnFailure, OnChanges, OnAlways, OnNever:
+		return c, nil
+	default:
+		return "", fmt.Errorf("invalid notify condition %q (want failure, changes, always or never)", v)
+	}
+}
+
+// Match 报告运行摘要是否满足条件。
+func (c Condition) Match(s Summary) bool {
+	switch c {
+	case OnAlways:
+		return true
+	case OnNever:
+		return false
+	case OnChanges:
+		return !s.Success || s.Changed
+	default:
+		return !s.Success
+	}
+}
+
+// Summary 为模板渲染使用的运行摘要，可直接访问 Result 的字段，如 {{.Job}}、{{.Totals.SubmittedFiles}}。
+type Summary struct {
+	*openlistsync.Result
+	// Changed 为本次是否提交了复制或删除了文件。
+	Changed bool
+	// Failures 为处理失败的复制项。
+	Failures []openlistsync.ItemResult
+}
+
+// NewSummary 由运行结果生成摘要。
+func NewSummary(res *openlistsync.Result) Summary {
+	s := Summary{Result: res}
+	s.Changed = res.Totals.SubmittedFiles > 0 || res.Totals.DeletedFiles > 0
+	for _, item := range res.Items {
+		if item.Outcome == openlistsync.ItemFailed {
+			s.Failures = append(s.Failures, item)
+		}
+	}
+	return s
+}
+
+// templateFuncs 为通知模板可用的函数：
+// json 把值编码为 JSON（字符串会带引号并转义），bytes 把字节数格式化为 KiB/MiB/GiB。
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"bytes": formatBytes,
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v := float64(n) / unit
+	for _, suffix := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		if v < unit || suffix == "TiB" {
+			return fmt.Sprintf("%.1f %s", v, suffix)
+		}
+		v /= unit
+	}
+	return ""
+}
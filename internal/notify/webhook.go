@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	DefaultWebhookTimeout      = 10 * time.Second
+	DefaultWebhookRetries      = 2
+	DefaultWebhookRetryBackoff = time.Second
+)
+
+// defaultWebhookBody 为未配置 body 时发送的 JSON。
+const defaultWebhookBody = `{"job":{{json .Job}},"success":{{.Success}},"error":{{json .Error}},"changed":{{.Changed}},"totals":{{json .Totals}}}`
+
+// WebhookConfig 为一个 webhook 的配置。
+type WebhookConfig struct {
+	URL string
+	// Method 为空时使用 POST。
+	Method  string
+	Headers map[string]string
+	// Body 为 text/template 模板，数据为 Summary；为空时发送默认 JSON 摘要。
+	Body string
+	On   Condition
+	// Timeout 为单次请求超时，<= 0 时使用默认值。
+	Timeout time.Duration
+	// Retries 为网络错误、HTTP 5xx、429 时的最多重试次数，0 表示不重试。
+	Retries int
+	// RetryBackoff 为首次重试前的等待时间，之后每次翻倍，<= 0 时使用默认值。
+	RetryBackoff time.Duration
+}
+
+// Webhook 为校验过、模板已解析的 webhook。
+type Webhook struct {
+	cfg        WebhookConfig
+	body       *template.Template
+	httpClient *http.Client
+}
+
+// NewWebhook 校验配置并解析 body 模板。
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	cfg.URL = strings.TrimSpace(cfg.URL)
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %q: want http(s)://host/...", cfg.URL)
+	}
+	cfg.Method = strings.ToUpper(strings.TrimSpace(cfg.Method))
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.On, err = ParseCondition(string(cfg.On)); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultWebhookTimeout
+	}
+	if cfg.Retries < 0 {
+		return nil, fmt.Errorf("webhook retries must be >= 0")
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultWebhookRetryBackoff
+	}
+	body := cfg.Body
+	if strings.TrimSpace(body) == "" {
+		body = defaultWebhookBody
+	}
+	tmpl, err := template.New("webhook").Funcs(templateFuncs).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook body template (%s): %w", u.Host, err)
+	}
+	return &Webhook{
+		cfg:        cfg,
+		body:       tmpl,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// String 返回用于日志的 webhook 标识（不含查询参数，避免泄露 URL 中的密钥）。
+func (w *Webhook) String() string {
+	u, err := url.Parse(w.cfg.URL)
+	if err != nil {
+		return w.cfg.Method
+	}
+	return w.cfg.Method + " " + u.Scheme + "://" + u.Host + u.Path
+}
+
+// Matches 报告该 webhook 是否需要为 s 发送。
+func (w *Webhook) Matches(s Summary) bool {
+	return w.cfg.On.Match(s)
+}
+
+// Send 渲染模板并发送请求，失败时按配置重试。返回最后一次失败的原因。
+func (w *Webhook) Send(ctx context.Context, s Summary) error {
+	var buf bytes.Buffer
+	if err := w.body.Execute(&buf, s); err != nil {
+		return fmt.Errorf("render webhook body: %w", err)
+	}
+	wait := w.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := w.sendOnce(ctx, buf.Bytes())
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= w.cfg.Retries {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		wait *= 2
+	}
+}
+
+// sendOnce 发送一次请求。网络错误、HTTP 5xx、429 视为可重试。
+func (w *Webhook) sendOnce(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, w.cfg.Method, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("build webhook request %s: %w", w, unwrapURLError(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("webhook %s request failed: %w", w, unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, fmt.Errorf("webhook returned status=%d body=%q", resp.StatusCode, strings.TrimSpace(string(respBody)))
+}
+
+// unwrapURLError 去掉 *url.Error 外层：它的错误信息带完整 URL，会泄露查询参数中的密钥。
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"op-sync/internal/openlistsync"
+)
+
+type webhookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bodies   []string
+	headers  []http.Header
+	statuses []int
+}
+
+// newWebhookServer 依次返回 statuses 中的状态码，用完后返回 200。
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	ws := &webhookServer{statuses: statuses}
+	ws.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+		ws.bodies = append(ws.bodies, string(b))
+		ws.headers = append(ws.headers, r.Header.Clone())
+		status := http.StatusOK
+		if len(ws.statuses) > 0 {
+			status, ws.statuses = ws.statuses[0], ws.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(ws.Close)
+	return ws
+}
+
+func failedSummary() Summary {
+	return NewSummary(&openlistsync.Result{
+		Job:    "movies",
+		Error:  `scan source failed: "boom"`,
+		Totals: openlistsync.ResultTotals{SubmittedFiles: 2, SubmittedBytes: 3 << 20, FailedFiles: 1},
+		Items: []openlistsync.ItemResult{
+			{RelPath: "a.mkv", Outcome: openlistsync.ItemSubmitted},
+			{RelPath: "b.mkv", Outcome: openlistsync.ItemFailed, Error: "storage busy"},
+		},
+	})
+}
+
+func TestWebhookSendTemplate(t *testing.T) {
+	ws := newWebhookServer(t)
+	w, err := NewWebhook(WebhookConfig{
+		URL:     ws.URL + "/hook?key=secret",
+		Headers: map[string]string{"X-Token": "abc"},
+		Body:    `{"text":{{json (printf "%s: %d copied (%s), %d failed, first: %s" .Job .Totals.SubmittedFiles (bytes .Totals.SubmittedBytes) (len .Failures) (index .Failures 0).RelPath)}},"error":{{json .Error}}}`,
+	})
+	if err != nil {
+		t.Fatalf("NewWebhook error: %v", err)
+	}
+	if err := w.Send(context.Background(), failedSummary()); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	want := `{"text":"movies: 2 copied (3.0 MiB), 1 failed, first: b.mkv","error":"scan source failed: \"boom\""}`
+	if len(ws.bodies) != 1 || ws.bodies[0] != want {
+		t.Fatalf("bodies = %q, want %q", ws.bodies, want)
+	}
+	if ws.headers[0].Get("X-Token") != "abc" || ws.headers[0].Get("Content-Type") != "application/json" {
+		t.Fatalf("headers = %v, unexpected", ws.headers[0])
+	}
+	if got := w.String(); got != "POST "+ws.URL+"/hook" {
+		t.Fatalf("String() = %q, want query stripped", got)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	ws := newWebhookServer(t, http.StatusBadGateway, http.StatusTooManyRequests)
+	w, err := NewWebhook(WebhookConfig{URL: ws.URL, Retries: 2, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewWebhook error: %v", err)
+	}
+	if err := w.Send(context.Background(), failedSummary()); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	if len(ws.bodies) != 3 {
+		t.Fatalf("calls = %d, want 3", len(ws.bodies))
+	}
+
+	ws = newWebhookServer(t, http.StatusBadRequest)
+	w, _ = NewWebhook(WebhookConfig{URL: ws.URL, Retries: 2, RetryBackoff: time.Millisecond})
+	if err := w.Send(context.Background(), failedSummary()); err == nil {
+		t.Fatalf("expected error for 400")
+	}
+	if len(ws.bodies) != 1 {
+		t.Fatalf("calls = %d, want 1 (4xx is not retried)", len(ws.bodies))
+	}
+}
+
+func TestWebhookErrorHidesQuery(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	for _, base := range []string{closed.URL, slow.URL} {
+		w, err := NewWebhook(WebhookConfig{URL: base + "/hook?token=s3cret", Timeout: 20 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("NewWebhook error: %v", err)
+		}
+		err = w.Send(context.Background(), failedSummary())
+		if err == nil {
+			t.Fatalf("Send to %s succeeded, want error", base)
+		}
+		if strings.Contains(err.Error(), "s3cret") || !strings.Contains(err.Error(), w.String()) {
+			t.Fatalf("err = %q, want webhook named by %q without query", err, w.String())
+		}
+	}
+}
+
+func TestNewWebhookInvalid(t *testing.T) {
+	for _, wc := range []WebhookConfig{
+		{URL: "ftp://example.com"},
+		{URL: "http://example.com", On: "sometimes"},
+		{URL: "http://example.com", Body: "{{.Job"},
+		{URL: "http://example.com", Retries: -1},
+	} {
+		if _, err := NewWebhook(wc); err == nil {
+			t.Fatalf("NewWebhook(%+v) = nil error, want error", wc)
+		}
+	}
+}
+
+func TestConditionMatch(t *testing.T) {
+	ok := NewSummary(&openlistsync.Result{Success: true})
+	changed := NewSummary(&openlistsync.Result{Success: true, Totals: openlistsync.ResultTotals{DeletedFiles: 1}})
+	failed := NewSummary(&openlistsync.Result{})
+	cases := []struct {
+		on   Condition
+		s    Summary
+		want bool
+	}{
+		{OnFailure, ok, false},
+		{OnFailure, changed, false},
+		{OnFailure, failed, true},
+		{OnChanges, ok, false},
+		{OnChanges, changed, true},
+		{OnChanges, failed, true},
+		{OnAlways, ok, true},
+	}
+	for _, c := range cases {
+		if got := c.on.Match(c.s); got != c.want {
+			t.Fatalf("%s.Match(success=%v changed=%v) = %v, want %v", c.on, c.s.Success, c.s.Changed, got, c.want)
+		}
+	}
+}
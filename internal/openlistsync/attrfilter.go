@@ -0,0 +1,148 @@
+package openlistsync
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExcludeReason 为文件被属性过滤排除的原因。
+type ExcludeReason string
+
+const (
+	ExcludeTooSmall ExcludeReason = "too_small"
+	ExcludeTooLarge ExcludeReason = "too_large"
+	ExcludeTooNew   ExcludeReason = "too_new"
+	ExcludeTooOld   ExcludeReason = "too_old"
+	ExcludeType     ExcludeReason = "type"
+)
+
+// fileTypes 为 OpenList /api/fs/list 返回的 type 取值（1 为目录，不参与过滤）。
+var fileTypes = map[string]int{
+	"unknown": 0,
+	"video":   2,
+	"audio":   3,
+	"text":    4,
+	"image":   5,
+}
+
+// ParseFileTypes 校验并规范化文件类型列表：unknown、video、audio、text、image。
+func ParseFileTypes(types []string) ([]string, error) {
+	out := make([]string, 0, len(types))
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if _, ok := fileTypes[t]; !ok {
+			return nil, fmt.Errorf("invalid file type %q: want unknown, video, audio, text or image", t)
+		}
+		if !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"tib", 1 << 40}, {"tb", 1 << 40}, {"t", 1 << 40},
+	{"gib", 1 << 30}, {"gb", 1 << 30}, {"g", 1 << 30},
+	{"mib", 1 << 20}, {"mb", 1 << 20}, {"m", 1 << 20},
+	{"kib", 1 << 10}, {"kb", 1 << 10}, {"k", 1 << 10},
+	{"b", 1},
+}
+
+// ParseSize 解析文件大小，如 "20GiB"、"1.5 GB"、"512k"、"1024"（无单位时为字节）。
+// 单位不区分大小写，KB/MB/GB/TB 与 KiB/MiB/GiB/TiB 一样按 1024 进位。
+func ParseSize(s string) (int64, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, u.suffix))
+			mult = u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	bytes := n * float64(mult)
+	// float64(math.MaxInt64) 会舍入为 2^63，必须用 >= 2^63 判断，否则 int64 转换会溢出。
+	if bytes >= 1<<63 {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return int64(math.Ceil(bytes)), nil
+}
+
+// attrFilter 按 list API 返回的元信息过滤源文件，只作用于文件，不影响目录遍历。
+// 修改时间为空（存储未提供）的文件不按时间过滤。
+type attrFilter struct {
+	minSize, maxSize int64
+	// newest 之后修改的文件视为仍在写入；oldest 之前修改的文件视为过旧。
+	newest, oldest time.Time
+	types          map[int]struct{}
+}
+
+// newAttrFilter 根据配置创建属性过滤器，未配置任何属性过滤时返回 nil。
+func newAttrFilter(cfg Config, now time.Time) *attrFilter {
+	if cfg.MinFileSize <= 0 && cfg.MaxFileSize <= 0 && cfg.MinAge <= 0 && cfg.ModifiedAfter.IsZero() && len(cfg.FileTypes) == 0 {
+		return nil
+	}
+	a := &attrFilter{minSize: cfg.MinFileSize, maxSize: cfg.MaxFileSize, oldest: cfg.ModifiedAfter}
+	if cfg.MinAge > 0 {
+		a.newest = now.Add(-cfg.MinAge)
+	}
+	if len(cfg.FileTypes) > 0 {
+		a.types = make(map[int]struct{}, len(cfg.FileTypes))
+		for _, t := range cfg.FileTypes {
+			a.types[fileTypes[t]] = struct{}{}
+		}
+	}
+	return a
+}
+
+// check 返回文件被排除的原因，保留时返回空字符串。
+func (a *attrFilter) check(obj fsObj) ExcludeReason {
+	if a == nil {
+		return ""
+	}
+	switch {
+	case a.minSize > 0 && obj.Size < a.minSize:
+		return ExcludeTooSmall
+	case a.maxSize > 0 && obj.Size > a.maxSize:
+		return ExcludeTooLarge
+	}
+	if !obj.Modified.IsZero() {
+		switch {
+		case !a.newest.IsZero() && obj.Modified.After(a.newest):
+			return ExcludeTooNew
+		case !a.oldest.IsZero() && obj.Modified.Before(a.oldest):
+			return ExcludeTooOld
+		}
+	}
+	if a.types != nil {
+		if _, ok := a.types[obj.Type]; !ok {
+			return ExcludeType
+		}
+	}
+	return ""
+}
+
+// protectExcluded 把源中被属性过滤排除的文件从目标快照中移除并记录到 Filtered，
+// 使其不参与比对，镜像模式也不会因为源中“缺少”这些文件而删除目标中的同名文件。
+func protectExcluded(dst *treeSnapshot, excluded map[string]ExcludeReason) {
+	for rel := range excluded {
+		if _, ok := dst.Files[rel]; ok {
+			delete(dst.Files, rel)
+			dst.Filtered[parentRel(rel)] = struct{}{}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package openlistsync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"1024":       1024,
+		"1KiB":       1024,
+		"1 kb":       1024,
+		"512k":       512 << 10,
+		"1.5GiB":     3 << 29,
+		"20GB":       20 << 30,
+		"2T":         2 << 40,
+		"100 B":      100,
+		" 3 MiB ":    3 << 20,
+		"8388607TiB": 8388607 << 40,
+	}
+	for in, want := range tests {
+		got, err := ParseSize(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "GiB", "-1", "1PiB", "abc", "8388608TiB", "9223372036854775808"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Fatalf("ParseSize(%q): expected error", in)
+		}
+	}
+}
+
+func TestParseFileTypes(t *testing.T) {
+	got, err := ParseFileTypes([]string{" Video", "audio", "video", ""})
+	if err != nil || len(got) != 2 || got[0] != "video" || got[1] != "audio" {
+		t.Fatalf("ParseFileTypes = %v, %v, want [video audio]", got, err)
+	}
+	if _, err := ParseFileTypes([]string{"folder"}); err == nil {
+		t.Fatalf("expected invalid file type error")
+	}
+}
+
+func TestAttrFilterCheck(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	if a := newAttrFilter(Config{}, now); a != nil {
+		t.Fatalf("newAttrFilter(empty) = %+v, want nil", a)
+	}
+	a := newAttrFilter(Config{
+		MinFileSize:   1024,
+		MaxFileSize:   1 << 30,
+		MinAge:        10 * time.Minute,
+		ModifiedAfter: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		FileTypes:     []string{"video", "unknown"},
+	}, now)
+
+	old := now.Add(-time.Hour)
+	tests := []struct {
+		name string
+		obj  fsObj
+		want ExcludeReason
+	}{
+		{name: "ok", obj: fsObj{Size: 2048, Modified: old, Type: 2}},
+		{name: "small", obj: fsObj{Size: 10, Modified: old, Type: 2}, want: ExcludeTooSmall},
+		{name: "large", obj: fsObj{Size: 2 << 30, Modified: old, Type: 2}, want: ExcludeTooLarge},
+		{name: "new", obj: fsObj{Size: 2048, Modified: now.Add(-time.Minute), Type: 2}, want: ExcludeTooNew},
+		{name: "old", obj: fsObj{Size: 2048, Modified: time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC), Type: 2}, want: ExcludeTooOld},
+		{name: "no modified", obj: fsObj{Size: 2048, Type: 0}},
+		{name: "type", obj: fsObj{Size: 2048, Modified: old, Type: 5}, want: ExcludeType},
+	}
+	for _, tt := range tests {
+		if got := a.check(tt.obj); got != tt.want {
+			t.Fatalf("%s: check = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunWithResultFileFilters(t *testing.T) {
+	recent := time.Now().Add(-time.Minute)
+	old := time.Now().Add(-time.Hour)
+	dirs := map[string][]fsObj{
+		"/src": {
+			{Name: "ok.mkv", Size: 4096, Modified: old},
+			{Name: "tiny.mkv", Size: 10, Modified: old},
+			{Name: "writing.mkv", Size: 4096, Modified: recent},
+		},
+		"/dst": {
+			{Name: "writing.mkv", Size: 100, Modified: old},
+			{Name: "gone.mkv", Size: 4096, Modified: old},
+		},
+	}
+	f := newFakeOpenList(t, dirs)
+	cfg := f.config()
+	cfg.MinFileSize = 1024
+	cfg.MinAge = 10 * time.Minute
+	cfg.Mirror = true
+	cfg.DryRun = true
+
+	res, err := RunWithResult(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("RunWithResult error: %v", err)
+	}
+	want := ExcludedSummary{TooSmall: 1, TooNew: 1}
+	if res.Scan.Excluded != want {
+		t.Fatalf("excluded = %+v, want %+v", res.Scan.Excluded, want)
+	}
+	if len(res.Items) != 1 || res.Items[0].RelPath != "ok.mkv" {
+		t.Fatalf("items = %+v, want only ok.mkv", res.Items)
+	}
+	// 源中仍在写入的 writing.mkv 被排除，目标中的旧版本不应被镜像删除。
+	if len(res.Deletes) != 1 || res.Deletes[0].RelPath != "gone.mkv" {
+		t.Fatalf("deletes = %+v, want only gone.mkv", res.Deletes)
+	}
+}
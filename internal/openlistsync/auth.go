@@ -0,0 +1,178 @@
+package openlistsync
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// passwdHashSalt 为 OpenList 计算 passwdhash 使用的固定盐值。
+const passwdHashSalt = "https://github.com/alist-org/alist"
+
+// Credentials 为登录 OpenList 使用的账号信息。
+// Password 与 PasswdHash 二选一；OTPSecret 为二步验证的 base32 密钥，OTPCode 为一次性验证码，
+// 两者都设置时优先使用 OTPCode。
+type Credentials struct {
+	Username   string
+	Password   string
+	PasswdHash string
+	OTPSecret  string
+	OTPCode    string
+}
+
+type loginReq struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	OTPCode  string `json:"otp_code,omitempty"`
+}
+
+type loginResp struct {
+	Token string `json:"token"`
+}
+
+// PasswdHash 按 OpenList 的规则计算密码杂凑：sha256("<password>-<salt>")。
+func PasswdHash(password string) string {
+	sum := sha256.Sum256([]byte(password + "-" + passwdHashSalt))
+	return hex.EncodeToString(sum[:])
+}
+
+// Enabled 报告是否配置了可用于登录的账号。
+func (c Credentials) Enabled() bool {
+	return c.Username != "" && (c.Password != "" || c.PasswdHash != "")
+}
+
+// Validate 校验账号配置，未配置账号时直接返回 nil。
+func (c Credentials) Validate() error {
+	if c.Password != "" && c.PasswdHash != "" {
+		return fmt.Errorf("password and passwdhash are mutually exclusive")
+	}
+	if c.Username == "" && (c.Password != "" || c.PasswdHash != "") {
+		return fmt.Errorf("username is required when password or passwdhash is set")
+	}
+	if c.PasswdHash != "" {
+		if _, err := hex.DecodeString(c.PasswdHash); err != nil || len(c.PasswdHash) != 64 {
+			return fmt.Errorf("passwdhash must be a 64-character hex SHA-256")
+		}
+	}
+	if c.OTPSecret != "" {
+		if _, err := decodeOTPSecret(c.OTPSecret); err != nil {
+			return fmt.Errorf("invalid otp_secret: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c Credentials) hash() string {
+	if c.PasswdHash != "" {
+		return strings.ToLower(c.PasswdHash)
+	}
+	return PasswdHash(c.Password)
+}
+
+func (c Credentials) otpCode(now time.Time) (string, error) {
+	if c.OTPCode != "" {
+		return c.OTPCode, nil
+	}
+	if c.OTPSecret == "" {
+		return "", nil
+	}
+	return totpCode(c.OTPSecret, now)
+}
+
+// Login 调用 /api/auth/login/hash 登录，返回新的 token。
+func Login(ctx context.Context, baseURL string, cred Credentials, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	c := &apiClient{
+		baseURL:    normalizeBaseURL(baseURL),
+		httpClient: &http.Client{Timeout: timeout},
+		cred:       cred,
+	}
+	return c.login(ctx)
+}
+
+// WriteTokenFile 把 token 写入文件（权限 0600），先写临时文件再改名，避免读到半截内容。
+func WriteTokenFile(tokenFile, token string) error {
+	return writeFileAtomic(tokenFile, []byte(token+"\n"), 0o600)
+}
+
+func (c *apiClient) login(ctx context.Context) (string, error) {
+	if !c.cred.Enabled() {
+		return "", fmt.Errorf("username and password (or passwdhash) are required to login")
+	}
+	if err := c.cred.Validate(); err != nil {
+		return "", err
+	}
+	otp, err := c.cred.otpCode(time.Now())
+	if err != nil {
+		return "", err
+	}
+	req := loginReq{Username: c.cred.Username, Password: c.cred.hash(), OTPCode: otp}
+	var resp loginResp
+	if err := c.request(ctx, http.MethodPost, "/api/auth/login/hash", req, &resp, false); err != nil {
+		return "", fmt.Errorf("login failed: %w", err)
+	}
+	if resp.Token == "" {
+		return "", fmt.Errorf("login failed: empty token in response")
+	}
+	return resp.Token, nil
+}
+
+// relogin 在 token 失效时重新登录。stale 为失败请求使用的 token：
+// 若其他 worker 已经换过 token，则直接使用新 token，不重复登录。
+func (c *apiClient) relogin(ctx context.Context, stale string) error {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if c.token != stale {
+		return nil
+	}
+	token, err := c.login(ctx)
+	if err != nil {
+		return err
+	}
+	c.token = token
+	c.logger.Info("token renewed by login", F("username", c.cred.Username))
+	if c.tokenFile != "" {
+		if err := WriteTokenFile(c.tokenFile, token); err != nil {
+			c.logger.Error("write token file failed", F("path", c.tokenFile), F("error", err))
+		}
+	}
+	return nil
+}
+
+func (c *apiClient) currentToken() string {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	return c.token
+}
+
+// totpCode 按 RFC 6238（HMAC-SHA1、30 秒、6 位）计算二步验证码。
+func totpCode(secret string, now time.Time) (string, error) {
+	key, err := decodeOTPSecret(secret)
+	if err != nil {
+		return "", fmt.Errorf("invalid otp_secret: %w", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(now.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", v%1000000), nil
+}
+
+func decodeOTPSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	s = strings.TrimRight(s, "=")
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+}
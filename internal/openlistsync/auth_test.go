@@ -0,0 +1,147 @@
+package openlistsync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasswdHash(t *testing.T) {
+	// echo -n 'password-https://github.com/alist-org/alist' | sha256sum
+	want := "0ee0be47182acad90a4307dd35cc06d901875e870b2637955a1188637ee56675"
+	if got := PasswdHash("password"); got != want {
+		t.Fatalf("PasswdHash = %s, want %s", got, want)
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 附录 B 的 SHA1 测试向量，密钥为 "12345678901234567890"。
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+	}
+	for ts, want := range cases {
+		got, err := totpCode(secret, time.Unix(ts, 0))
+		if err != nil {
+			t.Fatalf("totpCode error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("totpCode(%d) = %s, want %s", ts, got, want)
+		}
+	}
+}
+
+func TestCredentialsValidate(t *testing.T) {
+	bad := []Credentials{
+		{Username: "admin", Password: "p", PasswdHash: PasswdHash("p")},
+		{Password: "p"},
+		{Username: "admin", PasswdHash: "abc"},
+		{Username: "admin", Password: "p", OTPSecret: "not base32!"},
+	}
+	for _, c := range bad {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("Validate(%+v) = nil, want error", c)
+		}
+	}
+	if err := (Credentials{Username: "admin", Password: "p"}).Validate(); err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+}
+
+func TestRequestJSONReloginOnUnauthorized(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	var loginBody loginReq
+	f.handle("/api/auth/login/hash", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&loginBody)
+		writeAPIResp(w, 200, "success", loginResp{Token: "fresh"})
+	})
+	f.handle("/api/fs/copy", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "fresh" {
+			writeAPIResp(w, 401, "token is expired", nil)
+			return
+		}
+		writeAPIResp(w, 200, "success", nil)
+	})
+
+	tokenFile := filepath.Join(t.TempDir(), "token.txt")
+	cfg := f.config()
+	cfg.Credentials = Credentials{Username: "admin", Password: "secret"}
+	cfg.TokenFile = tokenFile
+	c := newAPIClient(cfg)
+
+	if _, err := c.copyFiles(context.Background(), "/src", "/dst", []string{"a.txt"}, true); err != nil {
+		t.Fatalf("copyFiles error: %v", err)
+	}
+	if n := f.callCount("/api/fs/copy"); n != 2 {
+		t.Fatalf("copy calls = %d, want 2 (rejected + replay)", n)
+	}
+	if loginBody.Username != "admin" || loginBody.Password != PasswdHash("secret") {
+		t.Fatalf("login body = %+v, unexpected", loginBody)
+	}
+	b, err := os.ReadFile(tokenFile)
+	if err != nil || strings.TrimSpace(string(b)) != "fresh" {
+		t.Fatalf("token file = %q (%v), want fresh", b, err)
+	}
+}
+
+func TestRequestJSONReloginOnlyOnce(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	f.handle("/api/auth/login/hash", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 200, "success", loginResp{Token: "fresh"})
+	})
+	f.handle("/api/me", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 401, "token is invalidated", nil)
+	})
+
+	cfg := f.config()
+	cfg.Credentials = Credentials{Username: "admin", Password: "secret"}
+	if _, err := newAPIClient(cfg).getCurrentUserBasePath(context.Background()); err == nil {
+		t.Fatalf("expected unauthorized error")
+	}
+	if n := f.callCount("/api/auth/login/hash"); n != 1 {
+		t.Fatalf("login calls = %d, want 1", n)
+	}
+	if n := f.callCount("/api/me"); n != 2 {
+		t.Fatalf("me calls = %d, want 2", n)
+	}
+}
+
+func TestRequestJSONLoginWhenTokenEmpty(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	f.handle("/api/auth/login/hash", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("login request carries Authorization header")
+		}
+		writeAPIResp(w, 200, "success", loginResp{Token: "fresh"})
+	})
+	f.handle("/api/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "fresh" {
+			writeAPIResp(w, 401, "token is empty", nil)
+			return
+		}
+		writeAPIResp(w, 200, "success", map[string]string{"base_path": "/"})
+	})
+
+	cfg, err := normalizeConfig(Config{
+		BaseURL:     f.server.URL,
+		SrcDir:      "/src",
+		DstDir:      "/dst",
+		Credentials: Credentials{Username: "admin", PasswdHash: PasswdHash("secret")},
+	})
+	if err != nil {
+		t.Fatalf("normalizeConfig error: %v", err)
+	}
+	if _, err := newAPIClient(cfg).getCurrentUserBasePath(context.Background()); err != nil {
+		t.Fatalf("getCurrentUserBasePath error: %v", err)
+	}
+	if n := f.callCount("/api/me"); n != 1 {
+		t.Fatalf("me calls = %d, want 1", n)
+	}
+}
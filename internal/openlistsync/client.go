@@ -4,17 +4,37 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type apiClient struct {
 	baseURL    string
-	token      string
 	perPage    int
 	logger     *Logger
 	httpClient *http.Client
+	limiter    *rateLimiter
+	retry      retryPolicy
+	observer   RequestObserver
+
+	// authMu 保护 token；token 失效且配置了 cred 时自动重新登录，新 token 写入 tokenFile。
+	authMu    sync.Mutex
+	token     string
+	cred      Credentials
+	tokenFile string
+}
+
+// RequestObserver 接收 API 请求的统计信息。status 为响应中的 code；
+// 响应无法解析时为 HTTP 状态码，请求未得到响应时为 "error"。
+type RequestObserver interface {
+	ObserveRequest(endpoint, status string, elapsed time.Duration)
 }
 
 type apiResp struct {
@@ -24,9 +44,18 @@ type apiResp struct {
 }
 
 type fsObj struct {
-	Name  string `json:"name"`
-	Size  int64  `json:"size"`
-	IsDir bool   `json:"is_dir"`
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	IsDir    bool      `json:"is_dir"`
+	Modified time.Time `json:"modified"`
+	// Type 为 OpenList 按扩展名判断的文件类型，见 fileTypes。
+	Type int `json:"type"`
+	// HashInfo 为存储提供的 hash，如 {"md5": "...", "sha1": "..."}，多数存储为空。
+	HashInfo map[string]string `json:"hash_info"`
+}
+
+type fsGetData struct {
+	RawURL string `json:"raw_url"`
 }
 
 type fsListData struct {
@@ -35,7 +64,17 @@ type fsListData struct {
 }
 
 type taskInfo struct {
-	Name string `json:"name"`
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	State    int        `json:"state"`
+	Status   string     `json:"status"`
+	Progress float64    `json:"progress"`
+	Error    string     `json:"error"`
+	EndTime  *time.Time `json:"end_time"`
+}
+
+type copyResp struct {
+	Tasks []taskInfo `json:"tasks"`
 }
 
 type currentUserInfo struct {
@@ -55,6 +94,11 @@ type mkdirReq struct {
 	Path string `json:"path"`
 }
 
+type removeReq struct {
+	Dir   string   `json:"dir"`
+	Names []string `json:"names"`
+}
+
 func newAPIClient(cfg Config) *apiClient {
 	return &apiClient{
 		baseURL: cfg.BaseURL,
@@ -64,6 +108,15 @@ func newAPIClient(cfg Config) *apiClient {
 		httpClient: &http.Client{
 			Timeout: cfg.Timeout,
 		},
+		limiter: sharedRateLimiter(cfg.BaseURL, cfg.RequestsPerSecond),
+		retry: retryPolicy{
+			max:     cfg.MaxRetries,
+			base:    cfg.RetryBackoff,
+			maxWait: cfg.RetryMaxBackoff,
+		},
+		cred:      cfg.Credentials,
+		tokenFile: cfg.TokenFile,
+		observer:  cfg.RequestObserver,
 	}
 }
 
@@ -78,6 +131,22 @@ func (c *apiClient) listUndoneCopyTasks(ctx context.Context) ([]taskInfo, error)
 	return tasks, nil
 }
 
+func (c *apiClient) listDoneCopyTasks(ctx context.Context) ([]taskInfo, error) {
+	var tasks []taskInfo
+	if err := c.requestJSON(ctx, http.MethodGet, "/api/task/copy/done", nil, &tasks); err != nil {
+		return nil, err
+	}
+	if tasks == nil {
+		return []taskInfo{}, nil
+	}
+	return tasks, nil
+}
+
+// retryCopyTask 让 OpenList 重新执行一个失败的复制任务。
+func (c *apiClient) retryCopyTask(ctx context.Context, id string) error {
+	return c.requestJSON(ctx, http.MethodPost, "/api/task/copy/retry?tid="+url.QueryEscape(id), nil, nil)
+}
+
 func (c *apiClient) getCurrentUserBasePath(ctx context.Context) (string, error) {
 	var user currentUserInfo
 	if err := c.requestJSON(ctx, http.MethodGet, "/api/me", nil, &user); err != nil {
@@ -86,22 +155,31 @@ func (c *apiClient) getCurrentUserBasePath(ctx context.Context) (string, error)
 	return normalizeOLPath(user.BasePath), nil
 }
 
-func (c *apiClient) copyFile(ctx context.Context, srcDir, dstDir, name string, overwrite bool) error {
+// copyFiles 把 srcDir 下的多个文件一次性复制到 dstDir，返回 OpenList 创建的任务（旧版本可能为空）。
+func (c *apiClient) copyFiles(ctx context.Context, srcDir, dstDir string, names []string, overwrite bool) ([]taskInfo, error) {
 	req := copyReq{
 		SrcDir:       normalizeOLPath(srcDir),
 		DstDir:       normalizeOLPath(dstDir),
-		Names:        []string{name},
+		Names:        names,
 		Overwrite:    overwrite,
 		SkipExisting: false,
 		Merge:        false,
 	}
-	return c.requestJSON(ctx, http.MethodPost, "/api/fs/copy", req, nil)
+	var resp copyResp
+	if err := c.requestJSON(ctx, http.MethodPost, "/api/fs/copy", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tasks, nil
 }
 
 func (c *apiClient) mkdir(ctx context.Context, p string) error {
 	return c.requestJSON(ctx, http.MethodPost, "/api/fs/mkdir", mkdirReq{Path: normalizeOLPath(p)}, nil)
 }
 
+func (c *apiClient) remove(ctx context.Context, dir string, names []string) error {
+	return c.requestJSON(ctx, http.MethodPost, "/api/fs/remove", removeReq{Dir: normalizeOLPath(dir), Names: names}, nil)
+}
+
 func (c *apiClient) listAllEntries(ctx context.Context, p string) ([]fsObj, error) {
 	p = normalizeOLPath(p)
 	var all []fsObj
@@ -131,45 +209,235 @@ func (c *apiClient) listAllEntries(ctx context.Context, p string) ([]fsObj, erro
 	return all, nil
 }
 
+// readFile 通过 /api/fs/get 返回的 raw_url 下载文件内容，超过 limit 字节时返回错误。
+// 下载与其他 API 请求一样限速、按 c.retry 重试并记录请求指标；
+// raw_url 可能指向第三方存储，只有与 OpenList 同源时才携带 token。
+func (c *apiClient) readFile(ctx context.Context, p string, limit int64) ([]byte, error) {
+	var data fsGetData
+	if err := c.requestJSON(ctx, http.MethodPost, "/api/fs/get", map[string]any{"path": normalizeOLPath(p)}, &data); err != nil {
+		return nil, err
+	}
+	rawURL := data.RawURL
+	if rawURL == "" {
+		return nil, fmt.Errorf("no raw_url for %s", p)
+	}
+	if strings.HasPrefix(rawURL, "/") {
+		rawURL = c.baseURL + rawURL
+	}
+	sameOrigin := strings.HasPrefix(rawURL, c.baseURL+"/")
+
+	var b []byte
+	err := c.withRetry(ctx, rawURLEndpoint, true, sameOrigin, func(token string) error {
+		var err error
+		b, err = c.downloadOnce(ctx, rawURL, token, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// rawURLEndpoint 为 raw_url 下载在日志和请求指标中使用的接口名。
+const rawURLEndpoint = "raw_url"
+
+// downloadOnce 下载一次 rawURL。可重试的失败以 *attemptError 返回。
+func (c *apiClient) downloadOnce(ctx context.Context, rawURL, token string, limit int64) (b []byte, err error) {
+	if err := c.limiter.wait(ctx); err != nil {
+		return nil, fmt.Errorf("request canceled: %w", err)
+	}
+	start := time.Now()
+	defer func() { c.observe(rawURLEndpoint, err, time.Since(start)) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// *url.Error 的信息带完整 raw_url，其中可能有签名参数，只保留底层错误。
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, &attemptError{err: fmt.Errorf("request failed: %w", err), notSent: isDialError(err)}
+	}
+	defer resp.Body.Close()
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 300))
+		return nil, &attemptError{
+			err:        &APIError{Endpoint: rawURLEndpoint, Status: resp.StatusCode, Message: strings.TrimSpace(string(body))},
+			status:     resp.StatusCode,
+			retryAfter: retryAfter,
+		}
+	}
+	b, err = io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, &attemptError{err: fmt.Errorf("read response body: %w", err), status: resp.StatusCode}
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("larger than %d bytes", limit)
+	}
+	return b, nil
+}
+
 // requestJSON 发送 OpenList API 请求，并解包标准响应：
 // {"code":..., "message":..., "data":...}
 // code 非 200 一律按错误处理。
+// 网络错误、5xx、429 等临时失败按 c.retry 重试，不可重放的接口只在请求确定未送达时重试。
+// token 失效且配置了账号时，重新登录后再重试一次。
 func (c *apiClient) requestJSON(ctx context.Context, method, apiPath string, payload any, out any) error {
-	var body io.Reader
+	return c.request(ctx, method, apiPath, payload, out, true)
+}
+
+// request 为 requestJSON 的实现；auth 为 false 时不携带 token（如登录接口）。
+func (c *apiClient) request(ctx context.Context, method, apiPath string, payload any, out any, auth bool) error {
+	var body []byte
 	if payload != nil {
 		b, err := json.Marshal(payload)
 		if err != nil {
 			return fmt.Errorf("marshal request body: %w", err)
 		}
-		body = bytes.NewReader(b)
+		body = b
+	}
+
+	return c.withRetry(ctx, apiPath, isIdempotentAPI(apiPath), auth, func(token string) error {
+		return c.requestOnce(ctx, method, apiPath, token, body, out)
+	})
+}
+
+// withRetry 执行 once，临时失败时按 c.retry 重试；auth 为 true 时传入当前 token，
+// token 失效且配置了账号时重新登录后再试一次。apiPath 只用于日志。
+func (c *apiClient) withRetry(ctx context.Context, apiPath string, idempotent, auth bool, once func(token string) error) error {
+	canRelogin := auth && c.cred.Enabled()
+	relogged := false
+	for attempt := 1; ; attempt++ {
+		token := ""
+		if auth {
+			token = c.currentToken()
+			if token == "" && canRelogin && !relogged {
+				relogged = true
+				if err := c.relogin(ctx, token); err != nil {
+					return err
+				}
+				token = c.currentToken()
+			}
+		}
+		err := once(token)
+		if err == nil {
+			return nil
+		}
+		var ae *attemptError
+		if errors.As(err, &ae) && ae.unauthorized() && canRelogin && !relogged {
+			// 401 说明请求在鉴权阶段被拒绝，重新登录后重放对不可重放的接口也是安全的。
+			relogged = true
+			c.logger.Info("token rejected, login again", F("endpoint", apiPath), F("code", ae.code))
+			if lerr := c.relogin(ctx, token); lerr != nil {
+				return fmt.Errorf("%w (re-login failed: %v)", err, lerr)
+			}
+			attempt--
+			continue
+		}
+		if !errors.As(err, &ae) || attempt > c.retry.max || ctx.Err() != nil || !ae.retryable(idempotent) {
+			// 不少错误是调用方预期内的（如首次同步时目标目录不存在、mkdir 时目录已存在），
+			// 这里只记 debug，由调用方决定是否按错误记录。
+			var apiErr *APIError
+			if errors.As(err, &apiErr) {
+				c.logger.Debug("api request failed", F("endpoint", apiErr.Endpoint), F("status", apiErr.Status), F("code", apiErr.Code), F("error", apiErr.Message))
+			}
+			return err
+		}
+		wait := c.retry.backoff(attempt, ae.retryAfter)
+		c.logger.Debug("api request failed, retry", F("endpoint", apiPath), F("attempt", attempt), F("max_attempts", c.retry.max+1), F("wait", wait), F("error", err))
+		if err := sleepCtx(ctx, wait); err != nil {
+			return fmt.Errorf("request canceled: %w", err)
+		}
+	}
+}
+
+// observe 把一次请求的结果交给 c.observer。
+func (c *apiClient) observe(apiPath string, err error, elapsed time.Duration) {
+	if c.observer == nil {
+		return
+	}
+	if i := strings.IndexByte(apiPath, '?'); i >= 0 {
+		apiPath = apiPath[:i]
+	}
+	status := "200"
+	var ae *attemptError
+	switch {
+	case err == nil:
+	case errors.As(err, &ae) && ae.code != 0:
+		status = strconv.Itoa(ae.code)
+	case ae != nil && ae.status != 0:
+		status = strconv.Itoa(ae.status)
+	default:
+		status = "error"
 	}
+	c.observer.ObserveRequest(apiPath, status, elapsed)
+}
+
+// requestOnce 发送一次请求。可重试的失败以 *attemptError 返回。
+func (c *apiClient) requestOnce(ctx context.Context, method, apiPath, token string, payload []byte, out any) (err error) {
+	if err := c.limiter.wait(ctx); err != nil {
+		return fmt.Errorf("request canceled: %w", err)
+	}
+	start := time.Now()
+	defer func() { c.observe(apiPath, err, time.Since(start)) }()
 
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
 	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+apiPath, body)
 	if err != nil {
 		return fmt.Errorf("build request: %w", err)
 	}
-	req.Header.Set("Authorization", c.token)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
 	req.Header.Set("Content-Type", "application/json;charset=UTF-8")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return &attemptError{err: fmt.Errorf("request failed: %w", err), notSent: isDialError(err)}
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("read response body: %w", err)
+		return &attemptError{err: fmt.Errorf("read response body: %w", err), status: resp.StatusCode}
 	}
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
 
 	var envelope apiResp
 	if err := json.Unmarshal(respBody, &envelope); err != nil {
-		return fmt.Errorf("decode response failed, status=%d body=%q", resp.StatusCode, truncateBytes(respBody, 300))
+		if resp.StatusCode >= 400 {
+			// 反向代理等返回的非 JSON 错误页。
+			return &attemptError{
+				err:        &APIError{Endpoint: apiPath, Status: resp.StatusCode, Message: truncateBytes(respBody, 300)},
+				status:     resp.StatusCode,
+				retryAfter: retryAfter,
+			}
+		}
+		return &attemptError{
+			err:        fmt.Errorf("decode response failed, status=%d body=%q", resp.StatusCode, truncateBytes(respBody, 300)),
+			status:     resp.StatusCode,
+			retryAfter: retryAfter,
+		}
 	}
 
 	if envelope.Code != 200 {
-		c.logger.Errorf("api %s failed: code=%d message=%s", apiPath, envelope.Code, envelope.Message)
-		return fmt.Errorf("api %s failed: code=%d message=%s", apiPath, envelope.Code, envelope.Message)
+		return &attemptError{
+			err:        &APIError{Endpoint: apiPath, Status: resp.StatusCode, Code: envelope.Code, Message: envelope.Message},
+			status:     resp.StatusCode,
+			code:       envelope.Code,
+			retryAfter: retryAfter,
+		}
 	}
 	if out == nil || len(envelope.Data) == 0 || string(envelope.Data) == "null" {
 		return nil
@@ -7,27 +7,117 @@ import (
 )
 
 const (
-	DefaultPerPage = 0
-	defaultTimeout = 30 * time.Second
+	DefaultPerPage        = 0
+	DefaultMaxDeleteRatio = 0.5
+	// DefaultScanConcurrency 为并发列目录的默认 worker 数。
+	DefaultScanConcurrency = 4
+	// DefaultSubmitConcurrency 为并发提交复制任务的默认 worker 数。
+	DefaultSubmitConcurrency = 4
+	// DefaultCopyBatchSize 为单次 /api/fs/copy 请求的默认最大文件数。
+	DefaultCopyBatchSize = 20
+	// DefaultTaskRefreshInterval 为运行中重新拉取未完成任务列表的默认间隔。
+	DefaultTaskRefreshInterval = time.Minute
+	// DefaultWaitInterval 为等待模式下轮询任务状态的默认间隔。
+	DefaultWaitInterval = 5 * time.Second
+	// DefaultTaskRetryBackoff 为失败任务首次重试前的默认等待时间。
+	DefaultTaskRetryBackoff = 30 * time.Second
+	// DefaultMaxRetries 为单个 API 请求遇到临时错误时的默认重试次数。
+	DefaultMaxRetries = 3
+	// DefaultStateGrace 为状态文件中提交记录的默认有效期。
+	DefaultStateGrace = time.Hour
+	// DefaultRetryBackoff / DefaultRetryMaxBackoff 为 API 请求重试的默认初始与最大等待时间。
+	DefaultRetryBackoff    = 500 * time.Millisecond
+	DefaultRetryMaxBackoff = 30 * time.Second
+	defaultTimeout         = 30 * time.Second
 )
 
 type Config struct {
-	BaseURL     string
-	Token       string
+	// Name 为 job 名称，非空时会出现在每一行日志中。
+	Name    string
+	BaseURL string
+	// Token 为 OpenList token；配置了 Credentials 时可为空，首次请求前自动登录。
+	Token string
+	// Credentials 非空时，token 失效会自动重新登录并重试一次请求。
+	Credentials Credentials
+	// TokenFile 为自动登录后写入新 token 的文件，为空时只在内存中使用。
+	TokenFile   string
 	SrcDir      string
 	DstDir      string
 	OutputDir   string
 	Blacklist   []string
+	Include     []string
 	MinSizeDiff int64
-	PerPage     int
-	Timeout     time.Duration
-	DryRun      bool
-	Logger      *Logger
+	// MinFileSize / MaxFileSize 为源文件大小范围（字节），0 表示不限制。
+	MinFileSize int64
+	MaxFileSize int64
+	// MinAge 非 0 时跳过最近 MinAge 内修改过的源文件（可能仍在写入）。
+	MinAge time.Duration
+	// ModifiedAfter 非零时跳过在此之前修改的源文件。
+	ModifiedAfter time.Time
+	// FileTypes 非空时只同步这些 OpenList 文件类型，见 ParseFileTypes。
+	FileTypes []string
+	// OverwritePolicy 为同名文件的覆盖策略，为空时等同 OverwriteLarger。
+	OverwritePolicy OverwritePolicy
+	// Compare 为同名文件的比对方式，为空时等同 CompareSize。
+	Compare CompareMode
+	PerPage int
+	// ScanConcurrency 为扫描目录树时并发列目录的 worker 数，<= 0 时使用默认值。
+	ScanConcurrency int
+	// SubmitConcurrency 为并发提交复制计划的 worker 数，<= 0 时使用默认值。
+	SubmitConcurrency int
+	// CopyBatchSize 为同一目录下合并到一次复制请求的最大文件数，<= 0 时使用默认值。
+	CopyBatchSize int
+	// TaskRefreshInterval 为运行中重新拉取未完成复制任务列表的间隔，0 表示每次运行只拉取一次。
+	TaskRefreshInterval time.Duration
+	// Wait 为 true 时提交后等待本次提交的复制任务结束，并按任务结果决定运行是否成功。
+	Wait bool
+	// WaitInterval 为等待模式下轮询任务状态的间隔，<= 0 时使用默认值。
+	WaitInterval time.Duration
+	// WaitTimeout 为等待模式的最长等待时间，0 表示不限制。
+	WaitTimeout time.Duration
+	// TaskRetries 为本次提交的任务在 OpenList 中失败后的最多重试次数，0 表示不重试。
+	// 大于 0 时会像 Wait 一样等待任务结束。
+	TaskRetries int
+	// TaskRetryBackoff 为首次重试前的等待时间，之后每次翻倍，<= 0 时使用默认值。
+	TaskRetryBackoff time.Duration
+	// RequestsPerSecond 为对同一 BaseURL 的每秒请求数上限，0 表示不限速。
+	// 同一进程内使用相同 BaseURL 和上限的所有 job 共享这个上限。
+	RequestsPerSecond float64
+	// MaxRetries 为单个 API 请求遇到网络错误、5xx、429 时的最多重试次数，0 表示不重试。
+	// 复制等不可重放的请求只在确定未送达服务端时重试。
+	MaxRetries int
+	// RetryBackoff 为首次重试前的等待时间，之后指数增长并叠加抖动，不超过 RetryMaxBackoff；
+	// <= 0 时使用默认值。
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+	Timeout         time.Duration
+	DryRun          bool
+	// Mirror 为 true 时删除目标中源已不存在的文件和目录。
+	Mirror bool
+	// MaxDelete 为单次允许删除的文件数上限，0 表示不限制。
+	MaxDelete int
+	// MaxDeleteRatio 为删除文件数占目标文件总数的比例上限（0~1），0 表示不限制。
+	MaxDeleteRatio float64
+	// RequestObserver 非空时接收每次 API 请求（含重试）的接口、状态与耗时，用于统计指标。
+	RequestObserver RequestObserver
+	// Progress 非空时在阶段切换和每个复制项处理完成时被调用，需尽快返回。
+	Progress func(Progress)
+	// ReportFile 非空时，每次运行结束后把 Result 以 JSON 写入该文件（覆盖写）。
+	ReportFile string
+	// StateFile 非空时记录已提交的文件；StateGrace 内源文件未变化的不会重复提交，<= 0 时使用默认值。
+	StateFile  string
+	StateGrace time.Duration
+	Logger     *Logger
 }
 
 func normalizeConfig(cfg Config) (Config, error) {
+	cfg.Name = strings.TrimSpace(cfg.Name)
 	cfg.Token = strings.TrimSpace(cfg.Token)
-	if cfg.Token == "" {
+	cfg.Credentials.Username = strings.TrimSpace(cfg.Credentials.Username)
+	if err := cfg.Credentials.Validate(); err != nil {
+		return Config{}, err
+	}
+	if cfg.Token == "" && !cfg.Credentials.Enabled() {
 		return Config{}, fmt.Errorf("token is empty")
 	}
 
@@ -47,17 +137,99 @@ func normalizeConfig(cfg Config) (Config, error) {
 	if cfg.MinSizeDiff < 0 {
 		return Config{}, fmt.Errorf("min_size_diff must be >= 0")
 	}
+	if cfg.MinFileSize < 0 || cfg.MaxFileSize < 0 {
+		return Config{}, fmt.Errorf("min_file_size and max_file_size must be >= 0")
+	}
+	if cfg.MaxFileSize > 0 && cfg.MaxFileSize < cfg.MinFileSize {
+		return Config{}, fmt.Errorf("max_file_size must be >= min_file_size")
+	}
+	if cfg.MinAge < 0 {
+		return Config{}, fmt.Errorf("min_age must be >= 0")
+	}
+	types, err := ParseFileTypes(cfg.FileTypes)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.FileTypes = types
+	policy, err := ParseOverwritePolicy(string(cfg.OverwritePolicy))
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.OverwritePolicy = policy
+	compare, err := ParseCompareMode(string(cfg.Compare))
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Compare = compare
+	if cfg.MaxDelete < 0 {
+		return Config{}, fmt.Errorf("max_delete must be >= 0")
+	}
+	cfg.StateFile = strings.TrimSpace(cfg.StateFile)
+	if cfg.StateGrace <= 0 {
+		cfg.StateGrace = DefaultStateGrace
+	}
+	if cfg.MaxDeleteRatio < 0 || cfg.MaxDeleteRatio > 1 {
+		return Config{}, fmt.Errorf("max_delete_ratio must be between 0 and 1")
+	}
+	if cfg.ScanConcurrency <= 0 {
+		cfg.ScanConcurrency = DefaultScanConcurrency
+	}
+	if cfg.SubmitConcurrency <= 0 {
+		cfg.SubmitConcurrency = DefaultSubmitConcurrency
+	}
+	if cfg.CopyBatchSize <= 0 {
+		cfg.CopyBatchSize = DefaultCopyBatchSize
+	}
+	if cfg.TaskRefreshInterval < 0 {
+		return Config{}, fmt.Errorf("task_refresh_interval must be >= 0")
+	}
+	if cfg.WaitInterval <= 0 {
+		cfg.WaitInterval = DefaultWaitInterval
+	}
+	if cfg.TaskRetries < 0 {
+		return Config{}, fmt.Errorf("task_retries must be >= 0")
+	}
+	if cfg.TaskRetryBackoff <= 0 {
+		cfg.TaskRetryBackoff = DefaultTaskRetryBackoff
+	}
+	if cfg.WaitTimeout < 0 {
+		return Config{}, fmt.Errorf("wait_timeout must be >= 0")
+	}
+	if cfg.MaxRetries < 0 {
+		return Config{}, fmt.Errorf("max_retries must be >= 0")
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	if cfg.RetryMaxBackoff <= 0 {
+		cfg.RetryMaxBackoff = DefaultRetryMaxBackoff
+	}
+	if cfg.RequestsPerSecond < 0 {
+		return Config{}, fmt.Errorf("requests_per_second must be >= 0")
+	}
 	if cfg.Timeout <= 0 {
 		cfg.Timeout = defaultTimeout
 	}
 	if cfg.Logger == nil {
 		cfg.Logger = NewLogger(nil, LogLevelError)
 	}
+	if cfg.Name != "" {
+		cfg.Logger = cfg.Logger.WithJob(cfg.Name)
+	}
 
 	cfg.BaseURL = normalizeBaseURL(cfg.BaseURL)
 	cfg.SrcDir = normalizeOLPath(cfg.SrcDir)
 	cfg.DstDir = normalizeOLPath(cfg.DstDir)
 	cfg.OutputDir = normalizeOLPath(cfg.OutputDir)
+	// 删除计划来自 dst 的列表，output 不同时会在另一棵树上按 dst 的内容删除。
+	if cfg.Mirror && cfg.OutputDir != cfg.DstDir {
+		return Config{}, fmt.Errorf("mirror requires output to be empty or equal to dst (dst=%s, output=%s)", cfg.DstDir, cfg.OutputDir)
+	}
+	// 在规范化（去掉空项、去重）之前校验，错误信息中的序号与配置一致。
+	if _, err := newPathFilter(cfg.Blacklist, cfg.Include); err != nil {
+		return Config{}, err
+	}
 	cfg.Blacklist = normalizePatterns(cfg.Blacklist)
+	cfg.Include = normalizePatterns(cfg.Include)
 	return cfg, nil
 }
@@ -1,6 +1,9 @@
 package openlistsync
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestNormalizeConfigOutputDefaultToDst(t *testing.T) {
 	cfg, err := normalizeConfig(Config{
@@ -32,3 +35,39 @@ func TestNormalizeConfigOutputNormalize(t *testing.T) {
 		t.Fatalf("output_dir=%q, want /out/sub", cfg.OutputDir)
 	}
 }
+
+func TestNormalizeConfigMirrorRequiresOutputEqualDst(t *testing.T) {
+	base := Config{
+		BaseURL: "http://localhost:35244",
+		Token:   "token",
+		SrcDir:  "/src",
+		DstDir:  "/dst",
+		Mirror:  true,
+	}
+	if _, err := normalizeConfig(base); err != nil {
+		t.Fatalf("normalizeConfig error: %v", err)
+	}
+	same := base
+	same.OutputDir = "dst/"
+	if _, err := normalizeConfig(same); err != nil {
+		t.Fatalf("normalizeConfig(output=dst/) error: %v", err)
+	}
+	other := base
+	other.OutputDir = "/out"
+	if _, err := normalizeConfig(other); err == nil || !strings.Contains(err.Error(), "mirror requires output") {
+		t.Fatalf("err = %v, want mirror/output error", err)
+	}
+}
+
+func TestNormalizeConfigInvalidPattern(t *testing.T) {
+	_, err := normalizeConfig(Config{
+		BaseURL:   "http://localhost:35244",
+		Token:     "token",
+		SrcDir:    "/src",
+		DstDir:    "/dst",
+		Blacklist: []string{"*.tmp", "*.tmp", `re:\d{8}(`},
+	})
+	if err == nil || !strings.Contains(err.Error(), "blacklist[2] `re:\\d{8}(`") {
+		t.Fatalf("err = %v, want error pointing at blacklist[2]", err)
+	}
+}
@@ -0,0 +1,92 @@
+package openlistsync
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError 为 OpenList 接口返回的错误：HTTP 状态码非 2xx，或响应 code 不是 200。
+type APIError struct {
+	// Endpoint 为接口路径，如 /api/fs/list。
+	Endpoint string
+	// Status 为 HTTP 状态码。
+	Status int
+	// Code 为响应中的 code，响应无法解析时为 0。
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("api %s failed: status=%d body=%q", e.Endpoint, e.Status, e.Message)
+	}
+	return fmt.Sprintf("api %s failed: code=%d message=%s", e.Endpoint, e.Code, e.Message)
+}
+
+// OpenList 对鉴权（401）、权限（403）等错误会给出专门的 code，但“不存在”“已存在”等
+// 业务错误大多统一以 code=500 返回，这时只能按 message 判断（见 matchAPIError）。
+// 以下列表只收录已知由 OpenList 产生的文案：internal/errs 中的内置错误，
+// 以及本地存储透传的系统调用错误（如 "mkdir /x: file exists"）。OpenList 调整文案后需要同步更新。
+var (
+	notFoundMessages = []string{
+		"object not found",
+		"storage not found",
+		"no such file or directory",
+	}
+	alreadyExistsMessages = []string{
+		"object already exists",
+		"file exists",
+	}
+	permissionDeniedMessages = []string{
+		"permission denied",
+	}
+)
+
+// IsNotFound 报告 err 是否表示路径或存储不存在。
+func IsNotFound(err error) bool {
+	return matchAPIError(err, http.StatusNotFound, notFoundMessages)
+}
+
+// IsAlreadyExists 报告 err 是否表示目标已存在。
+func IsAlreadyExists(err error) bool {
+	return matchAPIError(err, http.StatusConflict, alreadyExistsMessages)
+}
+
+// IsUnauthorized 报告 err 是否表示 token 缺失、无效或已过期。
+func IsUnauthorized(err error) bool {
+	return matchAPIError(err, http.StatusUnauthorized, nil)
+}
+
+// IsPermissionDenied 报告 err 是否表示当前用户无权执行该操作。
+func IsPermissionDenied(err error) bool {
+	return matchAPIError(err, http.StatusForbidden, permissionDeniedMessages)
+}
+
+// matchAPIError 判断 err 是否为 status 对应类别的 *APIError：
+//  1. HTTP 状态码或响应 code 等于 status（如 401、403、404、409）时直接命中；
+//  2. 响应 code 为 500 时按 message 判断：OpenList 以 "failed get dir: object not found" 的形式
+//     逐层包装错误，message 中以 ": " 分隔的某一段以 messages 中的文案开头才算命中，
+//     不做任意位置的子串匹配，避免把路径或第三方存储的错误描述误判；
+//  3. 其他 code 已经表明了具体类别，不再看 message。
+func matchAPIError(err error, status int, messages []string) bool {
+	var ae *APIError
+	if !errors.As(err, &ae) {
+		return false
+	}
+	if ae.Status == status || ae.Code == status {
+		return true
+	}
+	if ae.Code != http.StatusInternalServerError {
+		return false
+	}
+	for _, seg := range strings.Split(strings.ToLower(ae.Message), ": ") {
+		for _, m := range messages {
+			if strings.HasPrefix(strings.TrimSpace(seg), m) {
+				return true
+			}
+		}
+	}
+	return false
+}
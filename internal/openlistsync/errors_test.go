@@ -0,0 +1,125 @@
+package openlistsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAPIErrorHelpers(t *testing.T) {
+	cases := []struct {
+		err                                    error
+		notFound, exists, unauthorized, denied bool
+	}{
+		{err: &APIError{Status: 200, Code: 500, Message: "object not found"}, notFound: true},
+		{err: &APIError{Status: 404, Message: "<html>404</html>"}, notFound: true},
+		{err: &APIError{Status: 200, Code: 500, Message: "failed get storage: storage not found; please add a storage first"}, notFound: true},
+		{err: &APIError{Status: 200, Code: 500, Message: "file exists"}, exists: true},
+		{err: &APIError{Status: 200, Code: 401, Message: "token is expired"}, unauthorized: true},
+		{err: &APIError{Status: 200, Code: 403, Message: "您没有权限"}, denied: true},
+		{err: fmt.Errorf("scan /src: %w", &APIError{Status: 200, Code: 500, Message: "permission denied"}), denied: true},
+		// 路径中出现 "not found"/"exist" 不应影响判断。
+		{err: fmt.Errorf("mkdir /dst/exist/not found: %w", &APIError{Status: 200, Code: 500, Message: "driver error"})},
+		{err: errors.New("object not found")},
+		// 有明确的状态码或 code 时，不依赖 message 文案。
+		{err: &APIError{Status: 200, Code: 404, Message: "找不到对象"}, notFound: true},
+		{err: &APIError{Status: 200, Code: 409, Message: "目标已存在"}, exists: true},
+		{err: &APIError{Status: 401, Message: "session expired"}, unauthorized: true},
+		{err: &APIError{Status: 200, Code: 403, Message: "object not found"}, denied: true},
+		// 只有通用的 code=500 才按 message 判断；其他 code 或无法解析的响应不看 message。
+		{err: &APIError{Status: 200, Code: 400, Message: "path not found in request"}},
+		{err: &APIError{Status: 502, Message: "<html>file not found</html>"}},
+		// code=500 时只认 OpenList 已知的文案，且须位于以 ": " 分隔的某段开头。
+		{err: &APIError{Status: 200, Code: 500, Message: "failed get objs: failed get dir: object not found"}, notFound: true},
+		{err: &APIError{Status: 200, Code: 500, Message: "mkdir /data/a: file exists"}, exists: true},
+		{err: &APIError{Status: 200, Code: 500, Message: "upload failed: temp file not found"}},
+		{err: &APIError{Status: 200, Code: 500, Message: "failed link: upstream object not found in cache"}},
+		{err: &APIError{Status: 200, Code: 500, Message: "template index.html already exists in theme"}},
+	}
+	for _, c := range cases {
+		if got := IsNotFound(c.err); got != c.notFound {
+			t.Errorf("IsNotFound(%v) = %v, want %v", c.err, got, c.notFound)
+		}
+		if got := IsAlreadyExists(c.err); got != c.exists {
+			t.Errorf("IsAlreadyExists(%v) = %v, want %v", c.err, got, c.exists)
+		}
+		if got := IsUnauthorized(c.err); got != c.unauthorized {
+			t.Errorf("IsUnauthorized(%v) = %v, want %v", c.err, got, c.unauthorized)
+		}
+		if got := IsPermissionDenied(c.err); got != c.denied {
+			t.Errorf("IsPermissionDenied(%v) = %v, want %v", c.err, got, c.denied)
+		}
+	}
+}
+
+func TestRequestJSONReturnsAPIError(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	f.handle("/api/fs/mkdir", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 403, "permission denied", nil)
+	})
+
+	err := f.client().mkdir(context.Background(), "/dst/a")
+	var ae *APIError
+	if !errors.As(err, &ae) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if ae.Endpoint != "/api/fs/mkdir" || ae.Status != http.StatusOK || ae.Code != 403 || ae.Message != "permission denied" {
+		t.Fatalf("APIError = %+v, unexpected", ae)
+	}
+}
+
+func TestRequestJSONLogsAPIErrorAtDebug(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	for _, level := range []LogLevel{LogLevelInfo, LogLevelDebug} {
+		var buf bytes.Buffer
+		cfg := f.config()
+		cfg.Logger = NewLogger(&buf, level)
+		// 首次同步时目标目录不存在是预期内的错误，是否记录由调用方决定。
+		if _, err := newAPIClient(cfg).listAllEntries(context.Background(), "/dst"); !IsNotFound(err) {
+			t.Fatalf("err = %v, want not found", err)
+		}
+		if got, want := buf.Len() > 0, level == LogLevelDebug; got != want {
+			t.Fatalf("level %v: log = %q, want logged only at debug", level, buf.String())
+		}
+	}
+}
+
+func TestDirCacheAlreadyExists(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	f.handle("/api/fs/mkdir", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 500, "file exists", nil)
+	})
+	if err := newDirCache([]string{"/dst"}).ensureDir(context.Background(), f.client(), "/dst/a"); err != nil {
+		t.Fatalf("ensureDir error: %v, want existing dir treated as success", err)
+	}
+
+	f.handle("/api/fs/mkdir", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 500, "failed to make dir /dst/exist", nil)
+	})
+	if err := newDirCache([]string{"/dst"}).ensureDir(context.Background(), f.client(), "/dst/exist"); err == nil {
+		t.Fatalf("ensureDir succeeded, want error for unrelated mkdir failure")
+	}
+}
+
+func TestUndoneTaskIndexPermissionDenied(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	f.handle("/api/task/copy/undone", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 403, "permission denied", nil)
+	})
+	idx := newUndoneTaskIndex(f.client(), "/", 0)
+
+	dup, err := idx.has(context.Background(), "/src/a.txt", "/dst")
+	if err != nil || dup {
+		t.Fatalf("has = %v, %v; want false, nil", dup, err)
+	}
+	idx.add("/src/a.txt", "/dst")
+	if dup, _ := idx.has(context.Background(), "/src/a.txt", "/dst"); !dup {
+		t.Fatalf("own submission not detected as duplicate")
+	}
+	if n := f.callCount("/api/task/copy/undone"); n != 1 {
+		t.Fatalf("undone calls = %d, want 1", n)
+	}
+}
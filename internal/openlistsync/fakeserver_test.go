@@ -0,0 +1,102 @@
+package openlistsync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeOpenList 为测试用的 OpenList API 替身。
+// dirs 以绝对路径为 key 提供 /api/fs/list 的内容；
+// handlers 可覆盖或补充任意接口。
+type fakeOpenList struct {
+	t        *testing.T
+	mu       sync.Mutex
+	dirs     map[string][]fsObj
+	handlers map[string]http.HandlerFunc
+	calls    map[string]int
+	server   *httptest.Server
+}
+
+func newFakeOpenList(t *testing.T, dirs map[string][]fsObj) *fakeOpenList {
+	t.Helper()
+	f := &fakeOpenList{
+		t:        t,
+		dirs:     dirs,
+		handlers: make(map[string]http.HandlerFunc),
+		calls:    make(map[string]int),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeOpenList) handle(apiPath string, h http.HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[apiPath] = h
+}
+
+func (f *fakeOpenList) callCount(apiPath string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[apiPath]
+}
+
+// config 返回指向该替身的规范化配置，src=/src，dst=/dst。
+func (f *fakeOpenList) config() Config {
+	cfg, err := normalizeConfig(Config{
+		BaseURL: f.server.URL,
+		Token:   "token",
+		SrcDir:  "/src",
+		DstDir:  "/dst",
+	})
+	if err != nil {
+		f.t.Fatalf("normalizeConfig error: %v", err)
+	}
+	return cfg
+}
+
+func (f *fakeOpenList) client() *apiClient {
+	return newAPIClient(f.config())
+}
+
+func (f *fakeOpenList) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.calls[r.URL.Path]++
+	h := f.handlers[r.URL.Path]
+	f.mu.Unlock()
+	if h != nil {
+		h(w, r)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/fs/list":
+		var req struct {
+			Path string `json:"path"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		entries, ok := f.dirs[req.Path]
+		f.mu.Unlock()
+		if !ok {
+			writeAPIResp(w, 500, "object not found", nil)
+			return
+		}
+		writeAPIResp(w, 200, "success", fsListData{Content: entries, Total: int64(len(entries))})
+	default:
+		writeAPIResp(w, 200, "success", nil)
+	}
+}
+
+func writeAPIResp(w http.ResponseWriter, code int, message string, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"code":    code,
+		"message": message,
+		"data":    data,
+	})
+}
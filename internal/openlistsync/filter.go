@@ -3,22 +3,145 @@ package openlistsync
 import (
 	"fmt"
 	"path"
+	"regexp"
 	"slices"
 	"strings"
 )
 
+// ignoreFileName 为源目录中的忽略文件名，其中的规则追加在黑名单之后，只作用于所在目录的子树。
+const ignoreFileName = ".opsyncignore"
+
+// pathFilter 为扫描时的路径过滤规则：
+// - patterns 为黑名单，匹配的文件或目录（含其子树）被排除，优先于白名单
+// - includes 为白名单，非空时只保留匹配的文件；匹配的目录其下内容全部保留
+// - ignores 为各级目录忽略文件中的规则，按目录由浅到深排列
+// - attrs 为按大小、修改时间、类型过滤的规则，只作用于源文件
+// 每组规则内按顺序匹配，最后一个匹配的模式生效；!pattern 表示取消排除（或取消包含）。
 type pathFilter struct {
-	patterns []string
+	patterns []globPattern
+	includes []globPattern
+	ignores  []ignoreLayer
+	attrs    *attrFilter
+}
+
+// ignoreLayer 为目录 dir 下忽略文件中的规则，模式相对 dir 匹配。
+type ignoreLayer struct {
+	dir      string
+	patterns []globPattern
+}
+
+// globPattern 为解析后的通配符模式，按 / 分段匹配：
+// - 段 ** 匹配任意多层（含 0 层），其余段按 path.Match 匹配单层名称
+// - 以 / 开头或中间含 / 的模式相对同步根目录匹配完整路径，否则按名称在任意层级匹配
+// - 以 / 结尾的模式只匹配目录
+// - 以 re: 开头的模式为 Go 正则表达式，在相对路径中查找匹配（需要整体匹配时自行加 ^ 和 $）
+type globPattern struct {
+	segs    []string
+	re      *regexp.Regexp
+	dirOnly bool
+	negate  bool
+}
+
+func newPathFilter(patterns, includes []string) (*pathFilter, error) {
+	blacklist, err := compilePatterns("blacklist", patterns)
+	if err != nil {
+		return nil, err
+	}
+	whitelist, err := compilePatterns("include", includes)
+	if err != nil {
+		return nil, err
+	}
+	return &pathFilter{patterns: blacklist, includes: whitelist}, nil
+}
+
+// compilePatterns 逐条校验并解析模式，出错时指出是 kind 中的哪一条。
+func compilePatterns(kind string, patterns []string) ([]globPattern, error) {
+	for i, p := range patterns {
+		p = normalizePattern(p)
+		if p == "" {
+			continue
+		}
+		if _, err := compilePattern(p); err != nil {
+			return nil, fmt.Errorf("invalid %s[%d] %#q: %v", kind, i, p, err)
+		}
+	}
+	var out []globPattern
+	for _, p := range normalizePatterns(patterns) {
+		g, _ := compilePattern(p)
+		out = append(out, g)
+	}
+	return out, nil
+}
+
+func compilePattern(p string) (globPattern, error) {
+	var g globPattern
+	if strings.HasPrefix(p, "!") {
+		g.negate = true
+		p = strings.TrimPrefix(p[1:], "./")
+	}
+	if expr, ok := strings.CutPrefix(p, "re:"); ok {
+		if expr == "" {
+			return globPattern{}, fmt.Errorf("empty regular expression")
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return globPattern{}, err
+		}
+		g.re = re
+		return g, nil
+	}
+	anchored := strings.HasPrefix(p, "/")
+	g.dirOnly = strings.HasSuffix(p, "/")
+	p = strings.Trim(p, "/")
+	for _, seg := range strings.Split(p, "/") {
+		switch {
+		case seg == "":
+		case seg == "**":
+			// 连续的 ** 与单个等价。
+			if len(g.segs) == 0 || g.segs[len(g.segs)-1] != "**" {
+				g.segs = append(g.segs, seg)
+			}
+		default:
+			if _, err := path.Match(seg, "x"); err != nil {
+				return globPattern{}, err
+			}
+			g.segs = append(g.segs, seg)
+		}
+	}
+	if len(g.segs) == 0 {
+		return globPattern{}, path.ErrBadPattern
+	}
+	if !anchored && len(g.segs) == 1 && g.segs[0] != "**" {
+		g.segs = []string{"**", g.segs[0]}
+	}
+	return g, nil
 }
 
-func newPathFilter(patterns []string) (*pathFilter, error) {
-	normalized := normalizePatterns(patterns)
-	for _, p := range normalized {
-		if !isValidPattern(p) {
-			return nil, fmt.Errorf("invalid blacklist pattern: %s", p)
+// parseIgnoreFile 解析忽略文件：每行一个模式，忽略空行和 # 开头的注释行。
+func parseIgnoreFile(data []byte) ([]globPattern, error) {
+	var patterns []globPattern
+	for i, line := range strings.Split(string(data), "\n") {
+		p := normalizePattern(line)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
 		}
+		g, err := compilePattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern %#q: %v", i+1, p, err)
+		}
+		patterns = append(patterns, g)
+	}
+	return patterns, nil
+}
+
+// withIgnoreFile 返回追加了目录 dir 下忽略文件规则的过滤器，f 本身不变。
+func (f *pathFilter) withIgnoreFile(dir string, patterns []globPattern) *pathFilter {
+	out := &pathFilter{}
+	if f != nil {
+		*out = *f
 	}
-	return &pathFilter{patterns: normalized}, nil
+	out.ignores = append(slices.Clip(out.ignores), ignoreLayer{dir: dir, patterns: patterns})
+	return out
 }
 
 func (f *pathFilter) count() int {
@@ -28,27 +151,147 @@ func (f *pathFilter) count() int {
 	return len(f.patterns)
 }
 
-func (f *pathFilter) match(relPath string) bool {
-	if f == nil || len(f.patterns) == 0 {
+func (f *pathFilter) includeCount() int {
+	if f == nil {
+		return 0
+	}
+	return len(f.includes)
+}
+
+// match 报告 relPath 是否被黑名单或忽略文件排除。
+// 深层目录忽略文件中的规则晚于浅层目录和黑名单匹配，因此优先生效。
+func (f *pathFilter) match(relPath string, isDir bool) bool {
+	if f == nil {
 		return false
 	}
+	relPath = normalizeRelativePath(relPath)
+	excluded, _ := matchPatterns(f.patterns, relPath, isDir)
+	for _, l := range f.ignores {
+		rel, ok := relativeTo(l.dir, relPath)
+		if !ok {
+			continue
+		}
+		if matched, ok := matchPatterns(l.patterns, rel, isDir); ok {
+			excluded = matched
+		}
+	}
+	return excluded
+}
+
+// relativeTo 返回 relPath 相对目录 dir 的路径，relPath 不在 dir 之下时返回 false。
+func relativeTo(dir, relPath string) (string, bool) {
+	if dir == "" {
+		return relPath, true
+	}
+	rest, ok := strings.CutPrefix(relPath, dir+"/")
+	return rest, ok && rest != ""
+}
 
+// include 判断未被黑名单排除的条目是否在白名单范围内。
+// parentIncluded 为父目录是否在白名单内；条目未匹配任何白名单模式时沿用父目录的结果。
+// 返回的 included 为条目本身是否在白名单内，keep 为是否保留：
+// 文件 keep == included；目录在可能包含匹配的条目时也保留，以便继续遍历。
+func (f *pathFilter) include(relPath string, isDir, parentIncluded bool) (keep, included bool) {
+	if f.includeCount() == 0 {
+		return true, true
+	}
 	relPath = normalizeRelativePath(relPath)
-	baseName := path.Base(relPath)
-	for _, pattern := range f.patterns {
-		if strings.Contains(pattern, "/") {
-			if ok, _ := path.Match(pattern, relPath); ok {
-				return true
-			}
+	included = parentIncluded
+	if matched, ok := matchPatterns(f.includes, relPath, isDir); ok {
+		included = matched
+	}
+	if isDir && !included {
+		return f.mayContain(relPath), false
+	}
+	return included, included
+}
+
+// mayContain 报告目录 relDir 下是否可能有匹配白名单的条目，
+// 即 relDir 能否匹配某个模式的前几段（遇到 ** 或正则表达式时总是可能）。
+func (f *pathFilter) mayContain(relDir string) bool {
+	dirSegs := strings.Split(relDir, "/")
+	for _, g := range f.includes {
+		if g.negate {
 			continue
 		}
-		if ok, _ := path.Match(pattern, baseName); ok {
+		if g.re != nil || matchPrefix(g.segs, dirSegs) {
 			return true
 		}
 	}
 	return false
 }
 
+// matchPatterns 按最后一个匹配 relPath 的模式给出结果：ok 为是否有模式匹配，
+// matched 为该模式是否为正向模式（非 !pattern）。
+func matchPatterns(patterns []globPattern, relPath string, isDir bool) (matched, ok bool) {
+	if len(patterns) == 0 {
+		return false, false
+	}
+
+	relPath = normalizeRelativePath(relPath)
+	if relPath == "" {
+		return false, false
+	}
+	segs := strings.Split(relPath, "/")
+	for i := len(patterns) - 1; i >= 0; i-- {
+		g := patterns[i]
+		if g.dirOnly && !isDir {
+			continue
+		}
+		if g.re != nil {
+			if g.re.MatchString(relPath) {
+				return !g.negate, true
+			}
+			continue
+		}
+		if matchSegs(g.segs, segs) {
+			return !g.negate, true
+		}
+	}
+	return false, false
+}
+
+// matchSegs 报告 name 的各段是否完整匹配模式段 pat。
+func matchSegs(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegs(pat[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchPrefix 报告 dir 之下（至少再多一层）是否可能有路径匹配 pat。
+func matchPrefix(pat, dir []string) bool {
+	for len(dir) > 0 {
+		if len(pat) == 0 {
+			return false
+		}
+		if pat[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pat[0], dir[0]); !ok {
+			return false
+		}
+		pat, dir = pat[1:], dir[1:]
+	}
+	return len(pat) > 0
+}
+
+// normalizePatterns 规范化模式并去重。最后一个匹配的模式生效，
+// 因此重复的模式只保留最后一次出现的位置。
 func normalizePatterns(patterns []string) []string {
 	normalized := make([]string, 0, len(patterns))
 	for _, p := range patterns {
@@ -56,18 +299,20 @@ func normalizePatterns(patterns []string) []string {
 		if p == "" {
 			continue
 		}
-		if !slices.Contains(normalized, p) {
-			normalized = append(normalized, p)
-		}
+		normalized = slices.DeleteFunc(normalized, func(q string) bool { return q == p })
+		normalized = append(normalized, p)
 	}
 	return normalized
 }
 
 func normalizePattern(p string) string {
 	p = strings.TrimSpace(p)
+	if strings.HasPrefix(strings.TrimPrefix(p, "!"), "re:") {
+		// 正则表达式中的 \ 为转义符，不做路径规范化。
+		return p
+	}
 	p = strings.ReplaceAll(p, "\\", "/")
 	p = strings.TrimPrefix(p, "./")
-	p = strings.TrimPrefix(p, "/")
 	return p
 }
 
@@ -82,11 +327,3 @@ func normalizeRelativePath(relPath string) string {
 	}
 	return relPath
 }
-
-func isValidPattern(p string) bool {
-	if p == "" {
-		return true
-	}
-	_, err := path.Match(p, "x")
-	return err == nil
-}
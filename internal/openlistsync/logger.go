@@ -1,11 +1,15 @@
 package openlistsync
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type LogLevel int
@@ -29,9 +33,43 @@ func ParseLogLevel(s string) (LogLevel, error) {
 	}
 }
 
+// LogFormat 为日志输出格式。
+type LogFormat string
+
+const (
+	// LogFormatText 输出 "[INFO] [job] message key=value" 形式的文本。
+	LogFormatText LogFormat = "text"
+	// LogFormatJSON 每行输出一个 JSON 对象：time、level、msg、job 以及结构化字段。
+	LogFormatJSON LogFormat = "json"
+)
+
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "text", "":
+		return LogFormatText, nil
+	case "json":
+		return LogFormatJSON, nil
+	default:
+		return LogFormatText, fmt.Errorf("invalid log format: %s (allowed: text, json)", s)
+	}
+}
+
+// Field 为一条结构化日志字段，用 F 构造。
+type Field struct {
+	Key   string
+	Value any
+}
+
+// F 构造日志字段。常用 key：src、dst、rel_path、reason、error。
+func F(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
 type Logger struct {
-	base  *log.Logger
-	level LogLevel
+	base   *log.Logger
+	level  LogLevel
+	format LogFormat
+	job    string
 }
 
 func NewLogger(out io.Writer, level LogLevel) *Logger {
@@ -39,11 +77,38 @@ func NewLogger(out io.Writer, level LogLevel) *Logger {
 		out = os.Stdout
 	}
 	return &Logger{
-		base:  log.New(out, "", log.LstdFlags),
-		level: level,
+		base:   log.New(out, "", log.LstdFlags),
+		level:  level,
+		format: LogFormatText,
 	}
 }
 
+// WithFormat 返回使用指定输出格式的 Logger，与原 Logger 共享输出。
+func (l *Logger) WithFormat(format LogFormat) *Logger {
+	if l == nil {
+		return nil
+	}
+	cp := *l
+	cp.format = format
+	if format == LogFormatJSON {
+		// JSON 自带时间字段，不再使用 log 包的时间前缀。
+		cp.base = log.New(l.base.Writer(), "", 0)
+	} else {
+		cp.base = log.New(l.base.Writer(), "", log.LstdFlags)
+	}
+	return &cp
+}
+
+// WithJob 返回带 job 名称前缀的 Logger，与原 Logger 共享输出。
+func (l *Logger) WithJob(name string) *Logger {
+	if l == nil {
+		return nil
+	}
+	cp := *l
+	cp.job = name
+	return &cp
+}
+
 func (l *Logger) Debugf(format string, args ...any) {
 	l.logf(LogLevelDebug, "DEBUG", format, args...)
 }
@@ -56,12 +121,105 @@ func (l *Logger) Errorf(format string, args ...any) {
 	l.logf(LogLevelError, "ERROR", format, args...)
 }
 
+// Debug / Info / Error 输出带结构化字段的日志；文本格式下字段以 key=value 追加在消息后。
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.log(LogLevelDebug, "DEBUG", msg, fields)
+}
+
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.log(LogLevelInfo, "INFO", msg, fields)
+}
+
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.log(LogLevelError, "ERROR", msg, fields)
+}
+
 func (l *Logger) logf(level LogLevel, label, format string, args ...any) {
+	if l == nil || l.base == nil || level < l.level {
+		return
+	}
+	l.log(level, label, fmt.Sprintf(format, args...), nil)
+}
+
+func (l *Logger) log(level LogLevel, label, msg string, fields []Field) {
 	if l == nil || l.base == nil {
 		return
 	}
 	if level < l.level {
 		return
 	}
-	l.base.Printf("[%s] %s", label, fmt.Sprintf(format, args...))
+	if l.format == LogFormatJSON {
+		l.base.Print(l.jsonLine(label, msg, fields))
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] ", label)
+	if l.job != "" {
+		fmt.Fprintf(&b, "[%s] ", l.job)
+	}
+	b.WriteString(msg)
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(textValue(f.Value))
+	}
+	l.base.Print(b.String())
+}
+
+func (l *Logger) jsonLine(label, msg string, fields []Field) string {
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	writeJSONValue(&b, time.Now().Format("2006-01-02T15:04:05.000Z07:00"))
+	b.WriteString(`,"level":`)
+	writeJSONValue(&b, strings.ToLower(label))
+	b.WriteString(`,"msg":`)
+	writeJSONValue(&b, msg)
+	if l.job != "" {
+		b.WriteString(`,"job":`)
+		writeJSONValue(&b, l.job)
+	}
+	for _, f := range fields {
+		b.WriteByte(',')
+		writeJSONValue(&b, f.Key)
+		b.WriteByte(':')
+		writeJSONValue(&b, fieldValue(f.Value))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// fieldValue 把 error、Duration 等转换为便于阅读的字符串，其余值原样编码。
+func fieldValue(v any) any {
+	switch x := v.(type) {
+	case error:
+		return x.Error()
+	case time.Duration:
+		return x.String()
+	case fmt.Stringer:
+		return x.String()
+	default:
+		return v
+	}
+}
+
+// writeJSONValue 编码单个值，不转义路径中常见的 &、<、>。
+func writeJSONValue(b *bytes.Buffer, v any) {
+	var tmp bytes.Buffer
+	enc := json.NewEncoder(&tmp)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		tmp.Reset()
+		_ = enc.Encode(fmt.Sprint(v))
+	}
+	b.Write(bytes.TrimRight(tmp.Bytes(), "\n"))
+}
+
+func textValue(v any) string {
+	s := fmt.Sprint(fieldValue(v))
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
 }
@@ -0,0 +1,72 @@
+package openlistsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLoggerJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, LogLevelDebug).WithFormat(LogFormatJSON).WithJob("movies")
+
+	logger.Info("copy", F("src", "/a/b & c.mkv"), F("dst", "/d"), F("reason", "newer"), F("files", 3))
+	logger.Errorf("plain %s", "text")
+	logger.Error("copy failed", F("error", errors.New("boom")))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("lines = %d, want 3: %q", len(lines), buf.String())
+	}
+	var first map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("line is not JSON: %v (%s)", err, lines[0])
+	}
+	want := map[string]any{"level": "info", "msg": "copy", "job": "movies", "src": "/a/b & c.mkv", "dst": "/d", "reason": "newer", "files": float64(3)}
+	for k, v := range want {
+		if first[k] != v {
+			t.Fatalf("%s = %v, want %v (%s)", k, first[k], v, lines[0])
+		}
+	}
+	if _, ok := first["time"]; !ok {
+		t.Fatalf("missing time field: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[0], `{"time":`) {
+		t.Fatalf("line should start with time: %s", lines[0])
+	}
+
+	var third map[string]any
+	if err := json.Unmarshal([]byte(lines[2]), &third); err != nil || third["error"] != "boom" || third["level"] != "error" {
+		t.Fatalf("error line = %s (%v)", lines[2], err)
+	}
+}
+
+func TestLoggerTextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, LogLevelInfo).WithJob("movies")
+
+	logger.Info("copy", F("src", "/a b"), F("dst", "/d"))
+	logger.Debug("hidden", F("src", "/x"))
+
+	out := buf.String()
+	if !strings.Contains(out, `[INFO] [movies] copy src="/a b" dst=/d`) {
+		t.Fatalf("text output = %q", out)
+	}
+	if strings.Contains(out, "hidden") {
+		t.Fatalf("debug line should be filtered: %q", out)
+	}
+}
+
+func TestParseLogFormat(t *testing.T) {
+	if f, err := ParseLogFormat("JSON"); err != nil || f != LogFormatJSON {
+		t.Fatalf("ParseLogFormat(JSON) = %v, %v", f, err)
+	}
+	if f, err := ParseLogFormat(""); err != nil || f != LogFormatText {
+		t.Fatalf("ParseLogFormat(\"\") = %v, %v", f, err)
+	}
+	if _, err := ParseLogFormat("xml"); err == nil {
+		t.Fatalf("expected error for xml")
+	}
+}
@@ -0,0 +1,207 @@
+package openlistsync
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+type deletePlanItem struct {
+	RelPath string
+	IsDir   bool
+	// Files 为本项实际会删除的文件数（目录按其下文件计）。
+	Files int
+}
+
+// buildDeletePlan 找出目标中存在、源中不存在的文件和目录。
+// 规则：
+// - 源中不存在的目录，若其子树中没有被黑名单隐藏的条目，整体删除
+// - 其余源中不存在的文件逐个删除
+// - 被黑名单过滤的条目不会出现在快照里，因此不会被删除，包含它们的目录也会保留
+func buildDeletePlan(src, dst *treeSnapshot) []deletePlanItem {
+	keep := make(map[string]struct{})
+	for rel := range dst.Filtered {
+		for {
+			keep[rel] = struct{}{}
+			if rel == "" {
+				break
+			}
+			rel = parentRel(rel)
+		}
+	}
+
+	removableDirs := make(map[string]struct{})
+	for rel := range dst.Dirs {
+		if rel == "" {
+			continue
+		}
+		if _, ok := src.Dirs[rel]; ok {
+			continue
+		}
+		if _, ok := keep[rel]; ok {
+			continue
+		}
+		removableDirs[rel] = struct{}{}
+	}
+
+	plan := make([]deletePlanItem, 0)
+	dirIndex := make(map[string]int)
+	for rel := range removableDirs {
+		if _, ok := removableDirs[parentRel(rel)]; ok {
+			continue
+		}
+		dirIndex[rel] = len(plan)
+		plan = append(plan, deletePlanItem{RelPath: rel, IsDir: true})
+	}
+
+	for rel := range dst.Files {
+		if _, ok := src.Files[rel]; ok {
+			continue
+		}
+		if top, ok := topRemovedDir(rel, removableDirs); ok {
+			plan[dirIndex[top]].Files++
+			continue
+		}
+		plan = append(plan, deletePlanItem{RelPath: rel, Files: 1})
+	}
+
+	sort.Slice(plan, func(i, j int) bool {
+		return plan[i].RelPath < plan[j].RelPath
+	})
+	return plan
+}
+
+// topRemovedDir 返回 rel 所在的、将被整体删除的最上层目录。
+func topRemovedDir(rel string, removableDirs map[string]struct{}) (string, bool) {
+	top := ""
+	found := false
+	for dir := parentRel(rel); dir != ""; dir = parentRel(dir) {
+		if _, ok := removableDirs[dir]; ok {
+			top = dir
+			found = true
+		}
+	}
+	return top, found
+}
+
+func parentRel(rel string) string {
+	dir := path.Dir(rel)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// typeConflicts 返回在源和目标中类型不同的路径，即一侧是文件、另一侧是目录。
+// 复制无法直接覆盖这类路径，必须先删除目标中的旧条目。
+func typeConflicts(src, dst *treeSnapshot) map[string]struct{} {
+	conflicts := make(map[string]struct{})
+	for rel := range src.Files {
+		if _, ok := dst.Dirs[rel]; ok {
+			conflicts[rel] = struct{}{}
+		}
+	}
+	for rel := range src.Dirs {
+		if _, ok := dst.Files[rel]; ok {
+			conflicts[rel] = struct{}{}
+		}
+	}
+	return conflicts
+}
+
+// conflictOf 返回 rel 自身或其某个上级目录中的类型冲突路径。
+func conflictOf(rel string, conflicts map[string]struct{}) (string, bool) {
+	for p := rel; p != ""; p = parentRel(p) {
+		if _, ok := conflicts[p]; ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// splitSwapDeletes 从删除计划中分出类型冲突路径上的条目，这些条目要在提交复制前删除，
+// 其余条目留到复制确认完成之后。
+func splitSwapDeletes(plan []deletePlanItem, conflicts map[string]struct{}) (swaps, rest []deletePlanItem) {
+	for _, item := range plan {
+		if _, ok := conflicts[item.RelPath]; ok {
+			swaps = append(swaps, item)
+			continue
+		}
+		rest = append(rest, item)
+	}
+	return swaps, rest
+}
+
+// mirrorDeleteBlocker 返回镜像删除需要跳过的原因，空串表示可以删除。
+// 只有本轮复制全部成功，且提交的任务都已等待完成时才删除目标中多出的条目，
+// 否则源中的文件可能还没到达目标，目标里的旧文件就已经被删掉了。
+func mirrorDeleteBlocker(ctx context.Context, failed int, taskErr error, submitted, skippedDup, recentlySubmitted int, waited bool) string {
+	switch {
+	case ctx.Err() != nil:
+		return "canceled"
+	case failed > 0 || taskErr != nil:
+		return "copy failed"
+	case skippedDup > 0 || recentlySubmitted > 0:
+		return "earlier copy tasks not finished"
+	case submitted > 0 && !waited:
+		return "copy tasks not waited"
+	}
+	return ""
+}
+
+// checkDeleteLimits 在删除数量或比例超过阈值时拒绝执行，
+// 防止源目录异常（如挂载失效被列为空目录）时清空目标。
+func checkDeleteLimits(plan []deletePlanItem, dstFiles int, maxDelete int, maxRatio float64) (int, error) {
+	total := 0
+	for _, item := range plan {
+		total += item.Files
+	}
+	if maxDelete > 0 && total > maxDelete {
+		return total, fmt.Errorf("mirror refused: %d file(s) to delete exceeds max_delete=%d", total, maxDelete)
+	}
+	if maxRatio > 0 && dstFiles > 0 {
+		ratio := float64(total) / float64(dstFiles)
+		if ratio > maxRatio {
+			return total, fmt.Errorf("mirror refused: deleting %d of %d target file(s) (%.1f%%) exceeds max_delete_ratio=%.1f%%", total, dstFiles, ratio*100, maxRatio*100)
+		}
+	}
+	return total, nil
+}
+
+// deleteExtraneous 按父目录分组调用 remove API，返回成功与失败的条目数。
+func deleteExtraneous(ctx context.Context, c *apiClient, root string, plan []deletePlanItem, logger *Logger, rec *resultRecorder) (int, int) {
+	groups := make(map[string][]deletePlanItem)
+	var parents []string
+	for _, item := range plan {
+		parent := normalizeOLPath(path.Dir(joinRootWithRel(root, item.RelPath)))
+		if _, ok := groups[parent]; !ok {
+			parents = append(parents, parent)
+		}
+		groups[parent] = append(groups[parent], item)
+	}
+
+	var deleted, failed int
+	for _, parent := range parents {
+		items := groups[parent]
+		names := make([]string, len(items))
+		for i, item := range items {
+			names[i] = path.Base(item.RelPath)
+		}
+		err := c.remove(ctx, parent, names)
+		for _, item := range items {
+			rec.deleted(item.RelPath, err)
+		}
+		if err != nil {
+			failed += len(names)
+			logger.Error("delete failed", F("dst", parent), F("names", strings.Join(names, ", ")), F("error", err))
+			continue
+		}
+		deleted += len(names)
+		for _, item := range items {
+			logger.Info("delete", F("dst", joinRootWithRel(root, item.RelPath)), F("rel_path", item.RelPath), F("reason", "not in source"))
+		}
+	}
+	return deleted, failed
+}
@@ -0,0 +1,164 @@
+package openlistsync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OverwritePolicy 决定目标已存在同名文件时是否覆盖。
+type OverwritePolicy string
+
+const (
+	// OverwriteLarger 源文件更大时覆盖（默认）。
+	OverwriteLarger OverwritePolicy = "larger"
+	// OverwriteNewer 源文件修改时间更新时覆盖。
+	OverwriteNewer OverwritePolicy = "newer"
+	// OverwriteSizeDiffers 大小不同时覆盖。
+	OverwriteSizeDiffers OverwritePolicy = "size-differs"
+	// OverwriteNewerOrLarger 源文件更新或更大时覆盖。
+	OverwriteNewerOrLarger OverwritePolicy = "newer-or-larger"
+	// OverwriteAlways 总是覆盖。
+	OverwriteAlways OverwritePolicy = "always"
+	// OverwriteNever 从不覆盖，只复制目标缺失的文件。
+	OverwriteNever OverwritePolicy = "never"
+)
+
+// CompareMode 决定同名文件按什么比对。
+type CompareMode string
+
+const (
+	// CompareSize 按 OverwritePolicy 比对大小/修改时间（默认）。
+	CompareSize CompareMode = "size"
+	// CompareHash 两侧都提供同一算法的 hash 时按 hash 比对，否则回退到 OverwritePolicy。
+	CompareHash CompareMode = "hash"
+)
+
+// hashPreference 为 hash 算法的优先顺序，两侧都有时优先使用靠前的算法。
+var hashPreference = []string{"sha256", "sha1", "md5"}
+
+// mtimeTolerance 为比较修改时间时允许的误差，
+// 部分存储只保存到秒级甚至 2 秒精度。
+const mtimeTolerance = 2 * time.Second
+
+func ParseOverwritePolicy(s string) (OverwritePolicy, error) {
+	switch p := OverwritePolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return OverwriteLarger, nil
+	case OverwriteLarger, OverwriteNewer, OverwriteSizeDiffers, OverwriteNewerOrLarger, OverwriteAlways, OverwriteNever:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid overwrite policy: %s (allowed: larger, newer, size-differs, newer-or-larger, always, never)", s)
+	}
+}
+
+func ParseCompareMode(s string) (CompareMode, error) {
+	switch m := CompareMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return CompareSize, nil
+	case CompareSize, CompareHash:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid compare mode: %s (allowed: size, hash)", s)
+	}
+}
+
+// commonHash 返回两侧都提供的 hash 算法及各自的值。
+func commonHash(src, dst map[string]string) (string, string, string, bool) {
+	if len(src) == 0 || len(dst) == 0 {
+		return "", "", "", false
+	}
+	for _, algo := range hashPreference {
+		if sv, dv := src[algo], dst[algo]; sv != "" && dv != "" {
+			return algo, sv, dv, true
+		}
+	}
+	algos := make([]string, 0, len(src))
+	for algo := range src {
+		algos = append(algos, algo)
+	}
+	sort.Strings(algos)
+	for _, algo := range algos {
+		if sv, dv := src[algo], dst[algo]; sv != "" && dv != "" {
+			return algo, sv, dv, true
+		}
+	}
+	return "", "", "", false
+}
+
+// normalizeHashInfo 统一 hash 算法名与值的大小写，丢弃空值。
+func normalizeHashInfo(info map[string]string) map[string]string {
+	if len(info) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(info))
+	for algo, v := range info {
+		algo = strings.ToLower(strings.TrimSpace(algo))
+		v = strings.ToLower(strings.TrimSpace(v))
+		if algo == "" || v == "" {
+			continue
+		}
+		out[algo] = v
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// shouldOverwrite 按策略判断同名文件是否需要覆盖，返回值中的字符串为命中的规则说明。
+func shouldOverwrite(policy OverwritePolicy, src, dst fileMeta, minSizeDiff int64) (bool, string) {
+	switch policy {
+	case OverwriteNever:
+		return false, ""
+	case OverwriteAlways:
+		return true, "policy always, overwrite"
+	case OverwriteNewer:
+		return sourceNewer(src, dst)
+	case OverwriteSizeDiffers:
+		return sizeDiffers(src, dst, minSizeDiff)
+	case OverwriteNewerOrLarger:
+		if ok, reason := sourceNewer(src, dst); ok {
+			return true, reason
+		}
+		return sourceLarger(src, dst, minSizeDiff)
+	default:
+		return sourceLarger(src, dst, minSizeDiff)
+	}
+}
+
+func sourceLarger(src, dst fileMeta, minSizeDiff int64) (bool, string) {
+	diff := src.Size - dst.Size
+	if diff > 0 && diff >= minSizeDiff {
+		return true, fmt.Sprintf("source larger by %d bytes, overwrite", diff)
+	}
+	return false, ""
+}
+
+func sizeDiffers(src, dst fileMeta, minSizeDiff int64) (bool, string) {
+	diff := src.Size - dst.Size
+	abs := diff
+	if abs < 0 {
+		abs = -abs
+	}
+	if abs == 0 || abs < minSizeDiff {
+		return false, ""
+	}
+	if diff > 0 {
+		return true, fmt.Sprintf("source larger by %d bytes, overwrite", diff)
+	}
+	return true, fmt.Sprintf("source smaller by %d bytes, overwrite", abs)
+}
+
+// sourceNewer 任一侧缺少修改时间时视为无法判断，不覆盖。
+func sourceNewer(src, dst fileMeta) (bool, string) {
+	if src.Modified.IsZero() || dst.Modified.IsZero() {
+		return false, ""
+	}
+	diff := src.Modified.Sub(dst.Modified)
+	if diff > mtimeTolerance {
+		return true, fmt.Sprintf("source newer by %s, overwrite", diff.Round(time.Second))
+	}
+	return false, ""
+}
@@ -0,0 +1,41 @@
+package openlistsync
+
+// Phase 为一次运行所处的阶段。
+type Phase string
+
+const (
+	PhaseScanning   Phase = "scanning"
+	PhaseSubmitting Phase = "submitting"
+	// PhaseWaiting 只在等待模式下出现。
+	PhaseWaiting Phase = "waiting"
+	// PhaseDeleting 只在镜像模式下出现。
+	PhaseDeleting Phase = "deleting"
+)
+
+// Progress 为运行进度，在阶段切换和每个复制项处理完成时通过 Config.Progress 回调。
+type Progress struct {
+	Phase Phase `json:"phase"`
+	// PlannedFiles 为复制计划中的文件数，扫描完成前为 0。
+	PlannedFiles int `json:"planned_files"`
+	// ProcessedFiles 为已处理（提交、跳过或失败）的复制项数。
+	ProcessedFiles int `json:"processed_files"`
+	PlannedDeletes int `json:"planned_deletes"`
+}
+
+// phase 切换运行阶段并回调进度。
+func (r *resultRecorder) phase(p Phase) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.prog.Phase = p
+	prog := r.prog
+	r.mu.Unlock()
+	r.notify(prog)
+}
+
+func (r *resultRecorder) notify(prog Progress) {
+	if r.progress != nil {
+		r.progress(prog)
+	}
+}
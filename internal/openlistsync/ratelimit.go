@@ -0,0 +1,78 @@
+package openlistsync
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter 把请求均匀间隔到每秒不超过 rps 次。
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+type limiterKey struct {
+	baseURL string
+	rps     float64
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[limiterKey]*rateLimiter)
+)
+
+// sharedRateLimiter 返回 baseURL 对应的限速器。同一进程内访问同一 OpenList 的所有 job
+// 和每次运行共用一个限速器，rps 是对该 OpenList 的总上限，而不是每个 job 各自的上限。
+// rps <= 0 时返回 nil，表示不限速。
+func sharedRateLimiter(baseURL string, rps float64) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	key := limiterKey{baseURL: baseURL, rps: rps}
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[key]
+	if !ok {
+		l = newRateLimiter(rps)
+		limiters[key] = l
+	}
+	return l
+}
+
+// newRateLimiter 在 rps <= 0 时返回 nil，表示不限速。
+func newRateLimiter(rps float64) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// wait 阻塞到下一个可用的请求时间点，ctx 结束时提前返回错误。
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
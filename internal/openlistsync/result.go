@@ -0,0 +1,364 @@
+package openlistsync
+
+import (
+	"encoding/json"
+	"path"
+	"sync"
+	"time"
+)
+
+// ItemOutcome 为单个计划项的处理结果。
+type ItemOutcome string
+
+const (
+	// ItemPlanned 表示只生成了计划、没有提交（dry-run）。
+	ItemPlanned   ItemOutcome = "planned"
+	ItemSubmitted ItemOutcome = "submitted"
+	// ItemDuplicate 表示 OpenList 中已有相同的未完成任务，跳过提交。
+	ItemDuplicate ItemOutcome = "duplicate"
+	ItemFailed    ItemOutcome = "failed"
+	// ItemDeleted 只用于镜像模式的删除项。
+	ItemDeleted ItemOutcome = "deleted"
+)
+
+// Result 为一次 Run 的完整结果，可直接编码为 JSON 报告。
+type Result struct {
+	Job        string    `json:"job,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// DurationSeconds 为运行耗时（秒）。
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Success 为 Run 是否返回 nil；Error 为失败原因。
+	Success bool           `json:"success"`
+	Error   string         `json:"error,omitempty"`
+	Config  ResultConfig   `json:"config"`
+	Scan    ScanSummary    `json:"scan"`
+	Items   []ItemResult   `json:"items"`
+	Deletes []DeleteResult `json:"deletes,omitempty"`
+	Totals  ResultTotals   `json:"totals"`
+}
+
+// ResultConfig 为本次运行生效的主要配置（不含 token 等敏感信息）。
+type ResultConfig struct {
+	SrcDir          string          `json:"src"`
+	DstDir          string          `json:"dst"`
+	OutputDir       string          `json:"output"`
+	Blacklist       []string        `json:"blacklist,omitempty"`
+	Include         []string        `json:"include,omitempty"`
+	MinFileSize     int64           `json:"min_file_size,omitempty"`
+	MaxFileSize     int64           `json:"max_file_size,omitempty"`
+	MinAgeSeconds   float64         `json:"min_age_seconds,omitempty"`
+	ModifiedAfter   *time.Time      `json:"modified_after,omitempty"`
+	FileTypes       []string        `json:"file_types,omitempty"`
+	MinSizeDiff     int64           `json:"min_size_diff_kib"`
+	OverwritePolicy OverwritePolicy `json:"overwrite_policy"`
+	Compare         CompareMode     `json:"compare"`
+	DryRun          bool            `json:"dry_run"`
+	Mirror          bool            `json:"mirror"`
+	Wait            bool            `json:"wait"`
+}
+
+// ScanSummary 为扫描与比对的统计。
+type ScanSummary struct {
+	SourceFiles int `json:"source_files"`
+	SourceDirs  int `json:"source_dirs"`
+	TargetFiles int `json:"target_files"`
+	TargetDirs  int `json:"target_dirs"`
+	Unchanged   int `json:"unchanged"`
+	// ComparedByHash / ComparedBySize 只在 compare=hash 时有意义。
+	ComparedByHash int `json:"compared_by_hash"`
+	ComparedBySize int `json:"compared_by_size"`
+	// RecentlySubmitted 为宽限期内已提交过、本次跳过的文件数（需配置 StateFile）。
+	RecentlySubmitted int `json:"recently_submitted"`
+	// Excluded 为源中被大小、修改时间、类型过滤排除的文件数。
+	Excluded ExcludedSummary `json:"excluded"`
+}
+
+// ExcludedSummary 按原因统计被属性过滤排除的源文件数，见 ExcludeReason。
+type ExcludedSummary struct {
+	TooSmall int `json:"too_small"`
+	TooLarge int `json:"too_large"`
+	TooNew   int `json:"too_new"`
+	TooOld   int `json:"too_old"`
+	Type     int `json:"type"`
+}
+
+func countExcluded(excluded map[string]ExcludeReason) ExcludedSummary {
+	var s ExcludedSummary
+	for _, reason := range excluded {
+		switch reason {
+		case ExcludeTooSmall:
+			s.TooSmall++
+		case ExcludeTooLarge:
+			s.TooLarge++
+		case ExcludeTooNew:
+			s.TooNew++
+		case ExcludeTooOld:
+			s.TooOld++
+		case ExcludeType:
+			s.Type++
+		}
+	}
+	return s
+}
+
+// ItemResult 为一个待复制文件的计划与处理结果。
+type ItemResult struct {
+	RelPath string      `json:"rel_path"`
+	Src     string      `json:"src"`
+	DstDir  string      `json:"dst_dir"`
+	SrcSize int64       `json:"src_size"`
+	DstSize int64       `json:"dst_size"`
+	Reason  string      `json:"reason"`
+	Outcome ItemOutcome `json:"outcome"`
+	Error   string      `json:"error,omitempty"`
+	// Task 为等待模式下复制任务的最终状态：succeeded、failed、canceled、lost、unfinished。
+	Task      string `json:"task,omitempty"`
+	TaskError string `json:"task_error,omitempty"`
+}
+
+// DeleteResult 为镜像模式下一个删除项的结果。
+type DeleteResult struct {
+	RelPath string      `json:"rel_path"`
+	IsDir   bool        `json:"is_dir"`
+	Files   int         `json:"files"`
+	Outcome ItemOutcome `json:"outcome"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// ResultTotals 为按处理结果汇总的文件数与字节数（字节数按源文件大小计）。
+type ResultTotals struct {
+	PlannedFiles   int   `json:"planned_files"`
+	PlannedBytes   int64 `json:"planned_bytes"`
+	SubmittedFiles int   `json:"submitted_files"`
+	SubmittedBytes int64 `json:"submitted_bytes"`
+	DuplicateFiles int   `json:"duplicate_files"`
+	DuplicateBytes int64 `json:"duplicate_bytes"`
+	FailedFiles    int   `json:"failed_files"`
+	FailedBytes    int64 `json:"failed_bytes"`
+	// TaskFailedFiles 为等待模式下提交成功但任务最终未成功的文件数。
+	TaskFailedFiles int `json:"task_failed_files"`
+	DeletedFiles    int `json:"deleted_files"`
+	DeleteFailed    int `json:"delete_failed"`
+}
+
+// resultRecorder 在运行过程中并发安全地填充 Result。
+type resultRecorder struct {
+	mu      sync.Mutex
+	res     *Result
+	items   map[string]int
+	bySrc   map[string]int
+	deletes map[string]int
+
+	prog     Progress
+	progress func(Progress)
+}
+
+func newResultRecorder(res *Result) *resultRecorder {
+	return &resultRecorder{
+		res:     res,
+		items:   make(map[string]int),
+		bySrc:   make(map[string]int),
+		deletes: make(map[string]int),
+	}
+}
+
+func newResultConfig(cfg Config) ResultConfig {
+	var modifiedAfter *time.Time
+	if !cfg.ModifiedAfter.IsZero() {
+		modifiedAfter = &cfg.ModifiedAfter
+	}
+	return ResultConfig{
+		SrcDir:          cfg.SrcDir,
+		DstDir:          cfg.DstDir,
+		OutputDir:       cfg.OutputDir,
+		Blacklist:       cfg.Blacklist,
+		Include:         cfg.Include,
+		MinFileSize:     cfg.MinFileSize,
+		MaxFileSize:     cfg.MaxFileSize,
+		MinAgeSeconds:   cfg.MinAge.Seconds(),
+		ModifiedAfter:   modifiedAfter,
+		FileTypes:       cfg.FileTypes,
+		MinSizeDiff:     cfg.MinSizeDiff,
+		OverwritePolicy: cfg.OverwritePolicy,
+		Compare:         cfg.Compare,
+		DryRun:          cfg.DryRun,
+		Mirror:          cfg.Mirror,
+		Wait:            cfg.Wait || cfg.TaskRetries > 0,
+	}
+}
+
+// setPlan 登记复制和删除计划，所有项初始为 ItemPlanned。
+func (r *resultRecorder) setPlan(cfg Config, plan []copyPlanItem, deletePlan []deletePlanItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prog.PlannedFiles = len(plan)
+	r.prog.PlannedDeletes = len(deletePlan)
+	r.res.Items = make([]ItemResult, 0, len(plan))
+	for _, item := range plan {
+		src := joinRootWithRel(cfg.SrcDir, item.RelPath)
+		r.items[item.RelPath] = len(r.res.Items)
+		r.bySrc[src] = len(r.res.Items)
+		r.res.Items = append(r.res.Items, ItemResult{
+			RelPath: item.RelPath,
+			Src:     src,
+			DstDir:  normalizeOLPath(path.Dir(joinRootWithRel(cfg.OutputDir, item.RelPath))),
+			SrcSize: item.SrcSize,
+			DstSize: item.DstSize,
+			Reason:  item.Reason,
+			Outcome: ItemPlanned,
+		})
+	}
+	for _, item := range deletePlan {
+		r.deletes[item.RelPath] = len(r.res.Deletes)
+		r.res.Deletes = append(r.res.Deletes, DeleteResult{
+			RelPath: item.RelPath,
+			IsDir:   item.IsDir,
+			Files:   item.Files,
+			Outcome: ItemPlanned,
+		})
+	}
+}
+
+// setScan 记录扫描与比对统计。
+func (r *resultRecorder) setScan(src, dst *treeSnapshot, stats planStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.res.Scan = ScanSummary{
+		SourceFiles:       len(src.Files),
+		SourceDirs:        len(src.Dirs),
+		TargetFiles:       len(dst.Files),
+		TargetDirs:        len(dst.Dirs),
+		Unchanged:         stats.Unchanged,
+		ComparedByHash:    stats.ByHash,
+		ComparedBySize:    stats.BySize,
+		RecentlySubmitted: stats.RecentlySubmitted,
+		Excluded:          countExcluded(src.Excluded),
+	}
+}
+
+// item 记录复制项的处理结果，err 非空时记录为失败原因。
+func (r *resultRecorder) item(relPath string, outcome ItemOutcome, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	i, ok := r.items[relPath]
+	if !ok {
+		r.mu.Unlock()
+		return
+	}
+	if r.res.Items[i].Outcome == ItemPlanned && outcome != ItemPlanned {
+		r.prog.ProcessedFiles++
+	}
+	r.res.Items[i].Outcome = outcome
+	if err != nil {
+		r.res.Items[i].Error = err.Error()
+	}
+	prog := r.prog
+	r.mu.Unlock()
+	r.notify(prog)
+}
+
+// failPending 把仍未处理的复制项记为失败（如提交被取消）。
+func (r *resultRecorder) failPending(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.res.Items {
+		if r.res.Items[i].Outcome == ItemPlanned {
+			r.res.Items[i].Outcome = ItemFailed
+			if err != nil {
+				r.res.Items[i].Error = err.Error()
+			}
+		}
+	}
+}
+
+// tasks 记录等待模式下各任务的最终状态。
+func (r *resultRecorder) tasks(tasks []trackedTask) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, task := range tasks {
+		i, ok := r.bySrc[task.SrcFile]
+		if !ok {
+			continue
+		}
+		r.res.Items[i].Task = outcomeLabel(task.Outcome)
+		r.res.Items[i].TaskError = task.Error
+	}
+}
+
+func (r *resultRecorder) deleted(relPath string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, ok := r.deletes[relPath]
+	if !ok {
+		return
+	}
+	if err != nil {
+		r.res.Deletes[i].Outcome = ItemFailed
+		r.res.Deletes[i].Error = err.Error()
+		return
+	}
+	r.res.Deletes[i].Outcome = ItemDeleted
+}
+
+// finish 填写结束时间、错误信息与汇总。
+func (r *resultRecorder) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.res
+	res.FinishedAt = time.Now()
+	res.DurationSeconds = res.FinishedAt.Sub(res.StartedAt).Seconds()
+	res.Success = err == nil
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	t := ResultTotals{}
+	for _, item := range res.Items {
+		t.PlannedFiles++
+		t.PlannedBytes += item.SrcSize
+		switch item.Outcome {
+		case ItemSubmitted:
+			t.SubmittedFiles++
+			t.SubmittedBytes += item.SrcSize
+			if item.Task != "" && item.Task != outcomeLabel(taskOutcomeSucceeded) {
+				t.TaskFailedFiles++
+			}
+		case ItemDuplicate:
+			t.DuplicateFiles++
+			t.DuplicateBytes += item.SrcSize
+		case ItemFailed:
+			t.FailedFiles++
+			t.FailedBytes += item.SrcSize
+		}
+	}
+	for _, item := range res.Deletes {
+		switch item.Outcome {
+		case ItemDeleted:
+			t.DeletedFiles += item.Files
+		case ItemFailed:
+			t.DeleteFailed += item.Files
+		}
+	}
+	res.Totals = t
+}
+
+// writeReport 把结果以缩进 JSON 写入文件。
+func writeReport(reportFile string, res *Result) error {
+	b, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(reportFile, append(b, '\n'), 0o644)
+}
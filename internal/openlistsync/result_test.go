@@ -0,0 +1,119 @@
+package openlistsync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func resultTestServer(t *testing.T) *fakeOpenList {
+	dirs := map[string][]fsObj{
+		"/src":     {{Name: "a.txt", Size: 10}, {Name: "b.txt", Size: 20}, {Name: "sub", IsDir: true}},
+		"/src/sub": {{Name: "c.txt", Size: 5}},
+		"/dst":     {{Name: "b.txt", Size: 20}},
+	}
+	f := newFakeOpenList(t, dirs)
+	f.handle("/api/fs/copy", func(w http.ResponseWriter, r *http.Request) {
+		var req copyReq
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.SrcDir == "/src/sub" {
+			writeAPIResp(w, 500, "storage busy", nil)
+			return
+		}
+		writeAPIResp(w, 200, "success", nil)
+	})
+	return f
+}
+
+func TestRunWithResultReport(t *testing.T) {
+	f := resultTestServer(t)
+	cfg := f.config()
+	cfg.ReportFile = filepath.Join(t.TempDir(), "reports", "report.json")
+
+	res, err := RunWithResult(context.Background(), cfg)
+	if err == nil {
+		t.Fatalf("expected error for failed item")
+	}
+	if res.Success || res.Error == "" {
+		t.Fatalf("success=%v error=%q, want failure recorded", res.Success, res.Error)
+	}
+	if res.Scan.SourceFiles != 3 || res.Scan.TargetFiles != 1 || res.Scan.Unchanged != 1 {
+		t.Fatalf("scan = %+v, unexpected", res.Scan)
+	}
+	got := make(map[string]ItemResult)
+	for _, item := range res.Items {
+		got[item.RelPath] = item
+	}
+	if a := got["a.txt"]; a.Outcome != ItemSubmitted || a.Src != "/src/a.txt" || a.DstDir != "/dst" || a.Reason == "" {
+		t.Fatalf("a.txt = %+v, want submitted", a)
+	}
+	if c := got["sub/c.txt"]; c.Outcome != ItemFailed || c.Error == "" || c.DstDir != "/dst/sub" {
+		t.Fatalf("sub/c.txt = %+v, want failed with error", c)
+	}
+	want := ResultTotals{PlannedFiles: 2, PlannedBytes: 15, SubmittedFiles: 1, SubmittedBytes: 10, FailedFiles: 1, FailedBytes: 5}
+	if res.Totals != want {
+		t.Fatalf("totals = %+v, want %+v", res.Totals, want)
+	}
+
+	b, err := os.ReadFile(cfg.ReportFile)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	var report Result
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if report.Totals != want || len(report.Items) != 2 || report.Config.SrcDir != "/src" {
+		t.Fatalf("report = %+v, unexpected", report)
+	}
+}
+
+func TestRunWithResultDryRun(t *testing.T) {
+	f := resultTestServer(t)
+	cfg := f.config()
+	cfg.DryRun = true
+
+	res, err := RunWithResult(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("RunWithResult error: %v", err)
+	}
+	if !res.Success || !res.Config.DryRun || len(res.Items) != 2 {
+		t.Fatalf("result = %+v, unexpected", res)
+	}
+	for _, item := range res.Items {
+		if item.Outcome != ItemPlanned {
+			t.Fatalf("%s outcome = %s, want planned", item.RelPath, item.Outcome)
+		}
+	}
+	if n := f.callCount("/api/fs/copy"); n != 0 {
+		t.Fatalf("copy calls = %d, want 0 in dry-run", n)
+	}
+}
+
+func TestRunWithResultProgress(t *testing.T) {
+	f := resultTestServer(t)
+	cfg := f.config()
+	var mu sync.Mutex
+	var phases []Phase
+	var last Progress
+	cfg.Progress = func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(phases) == 0 || phases[len(phases)-1] != p.Phase {
+			phases = append(phases, p.Phase)
+		}
+		last = p
+	}
+
+	_, _ = RunWithResult(context.Background(), cfg)
+	if len(phases) != 2 || phases[0] != PhaseScanning || phases[1] != PhaseSubmitting {
+		t.Fatalf("phases = %v, want [scanning submitting]", phases)
+	}
+	if last.PlannedFiles != 2 || last.ProcessedFiles != 2 {
+		t.Fatalf("last progress = %+v, want 2/2", last)
+	}
+}
@@ -0,0 +1,139 @@
+package openlistsync
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// idempotentAPIs 为可以安全重放的接口；其余接口（如 /api/fs/copy）只在请求确定未送达时重试，
+// 避免重复提交。
+var idempotentAPIs = map[string]struct{}{
+	"/api/fs/list":          {},
+	"/api/fs/get":           {},
+	"/api/me":               {},
+	"/api/task/copy/undone": {},
+	"/api/task/copy/done":   {},
+}
+
+func isIdempotentAPI(apiPath string) bool {
+	if i := strings.IndexByte(apiPath, '?'); i >= 0 {
+		apiPath = apiPath[:i]
+	}
+	_, ok := idempotentAPIs[apiPath]
+	return ok
+}
+
+// retryPolicy 为 requestJSON 的传输层重试策略。
+type retryPolicy struct {
+	// max 为首次请求之外的最多重试次数，0 表示不重试。
+	max     int
+	base    time.Duration
+	maxWait time.Duration
+}
+
+// backoff 返回第 attempt 次重试（从 1 开始）前的等待时间：指数退避并叠加随机抖动，
+// 服务端给出 Retry-After 时以其为准（不超过 maxWait）。
+func (p retryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, p.maxWait)
+	}
+	d := p.base
+	for i := 1; i < attempt && d < p.maxWait; i++ {
+		d *= 2
+	}
+	d = min(d, p.maxWait)
+	if d <= 0 {
+		return 0
+	}
+	// 在 [d/2, d] 内取随机值，避免多个 worker 同时重试。
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// attemptError 为单次请求的失败信息，供重试判断使用。
+type attemptError struct {
+	err error
+	// status 为 HTTP 状态码，请求未拿到响应时为 0。
+	status int
+	// code 为 OpenList 响应中的 code，响应无法解析时为 0。
+	code       int
+	retryAfter time.Duration
+	// notSent 表示请求确定没有送达服务端（如建立连接失败）。
+	notSent bool
+}
+
+func (e *attemptError) Error() string { return e.err.Error() }
+func (e *attemptError) Unwrap() error { return e.err }
+
+// unauthorized 报告请求是否因 token 无效或过期被拒绝。
+func (e *attemptError) unauthorized() bool {
+	return IsUnauthorized(e.err)
+}
+
+// retryable 判断失败的请求是否值得重试。
+// 可重放接口：网络错误、HTTP 5xx/429、code 为 429 或 5xx（“not found” 除外）时重试；
+// 不可重放接口：仅在请求未送达或服务端明确限流（429）时重试。
+func (e *attemptError) retryable(idempotent bool) bool {
+	if e.status == http.StatusTooManyRequests || e.code == http.StatusTooManyRequests || e.notSent {
+		return true
+	}
+	if !idempotent {
+		return false
+	}
+	switch {
+	case e.status == 0:
+		return true
+	case e.status >= 500:
+		return true
+	case e.code >= 500:
+		return !IsNotFound(e.err) && !IsPermissionDenied(e.err) && !IsAlreadyExists(e.err)
+	default:
+		return false
+	}
+}
+
+// isDialError 判断错误是否发生在建立连接阶段，此时请求一定没有送达。
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// parseRetryAfter 解析 Retry-After 头，支持秒数和 HTTP 日期两种格式。
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,153 @@
+package openlistsync
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func retryTestClient(f *fakeOpenList) *apiClient {
+	cfg := f.config()
+	cfg.MaxRetries = 3
+	cfg.RetryBackoff = time.Millisecond
+	cfg.RetryMaxBackoff = 10 * time.Millisecond
+	return newAPIClient(cfg)
+}
+
+func TestRequestJSONRetriesIdempotent(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	calls := 0
+	f.handle("/api/me", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("<html>bad gateway</html>"))
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			writeAPIResp(w, 429, "too many requests", nil)
+		default:
+			writeAPIResp(w, 200, "success", map[string]string{"base_path": "/root"})
+		}
+	})
+
+	base, err := retryTestClient(f).getCurrentUserBasePath(context.Background())
+	if err != nil {
+		t.Fatalf("getCurrentUserBasePath error: %v", err)
+	}
+	if base != "/root" || calls != 3 {
+		t.Fatalf("base=%q calls=%d, want /root after 3 calls", base, calls)
+	}
+}
+
+type recordingObserver struct {
+	mu       sync.Mutex
+	observed []string
+}
+
+func (o *recordingObserver) ObserveRequest(endpoint, status string, _ time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.observed = append(o.observed, endpoint+" "+status)
+}
+
+func TestRequestJSONObservesEachAttempt(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	calls := 0
+	f.handle("/api/me", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			writeAPIResp(w, 429, "too many requests", nil)
+		default:
+			writeAPIResp(w, 200, "success", map[string]string{"base_path": "/"})
+		}
+	})
+
+	obs := &recordingObserver{}
+	c := retryTestClient(f)
+	c.observer = obs
+	if _, err := c.getCurrentUserBasePath(context.Background()); err != nil {
+		t.Fatalf("getCurrentUserBasePath error: %v", err)
+	}
+	want := []string{"/api/me 502", "/api/me 429", "/api/me 200"}
+	if strings.Join(obs.observed, ",") != strings.Join(want, ",") {
+		t.Fatalf("observed = %v, want %v", obs.observed, want)
+	}
+}
+
+func TestRequestJSONNoRetryForCopy(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	f.handle("/api/fs/copy", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 500, "storage busy", nil)
+	})
+
+	if _, err := retryTestClient(f).copyFiles(context.Background(), "/src", "/dst", []string{"a.txt"}, true); err == nil {
+		t.Fatalf("expected copy error")
+	}
+	if n := f.callCount("/api/fs/copy"); n != 1 {
+		t.Fatalf("copy calls = %d, want 1 (no retry for non-idempotent api)", n)
+	}
+}
+
+func TestRequestJSONNoRetryForNotFound(t *testing.T) {
+	f := newFakeOpenList(t, map[string][]fsObj{})
+
+	if _, err := retryTestClient(f).listAllEntries(context.Background(), "/missing"); err == nil {
+		t.Fatalf("expected not found error")
+	}
+	if n := f.callCount("/api/fs/list"); n != 1 {
+		t.Fatalf("list calls = %d, want 1 (not found is not retried)", n)
+	}
+}
+
+func TestRequestJSONRetryOnDialError(t *testing.T) {
+	cfg, err := normalizeConfig(Config{
+		BaseURL:      "http://127.0.0.1:1",
+		Token:        "token",
+		SrcDir:       "/src",
+		DstDir:       "/dst",
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("normalizeConfig error: %v", err)
+	}
+	_, err = newAPIClient(cfg).copyFiles(context.Background(), "/src", "/dst", []string{"a.txt"}, true)
+	var ae *attemptError
+	if !errors.As(err, &ae) || !ae.notSent || !ae.retryable(false) {
+		t.Fatalf("err = %v, want retryable not-sent error for copy", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 3, 10, 0, 0, 0, time.UTC)
+	if d := parseRetryAfter("5", now); d != 5*time.Second {
+		t.Fatalf("parseRetryAfter(5) = %s, want 5s", d)
+	}
+	if d := parseRetryAfter("Tue, 03 Mar 2026 10:00:30 GMT", now); d != 30*time.Second {
+		t.Fatalf("parseRetryAfter(date) = %s, want 30s", d)
+	}
+	if d := parseRetryAfter("soon", now); d != 0 {
+		t.Fatalf("parseRetryAfter(invalid) = %s, want 0", d)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := retryPolicy{max: 5, base: 100 * time.Millisecond, maxWait: time.Second}
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 8: time.Second} {
+		d := p.backoff(attempt, 0)
+		if d < max/2 || d > max {
+			t.Fatalf("backoff(%d) = %s, want within [%s, %s]", attempt, d, max/2, max)
+		}
+	}
+	if d := p.backoff(1, 10*time.Second); d != time.Second {
+		t.Fatalf("backoff with Retry-After = %s, want capped at 1s", d)
+	}
+}
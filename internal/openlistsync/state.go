@@ -0,0 +1,135 @@
+package openlistsync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+const stateVersion = 1
+
+// syncState 为持久化的提交记录：源文件绝对路径 -> 最近一次提交的信息。
+// 目标存储列目录有延迟，或复制任务在检查未完成任务之后、下次列目录之前刚好完成时，
+// 目标中看到的仍是旧文件；宽限期内源文件没有再变化时不重复提交。
+type syncState struct {
+	path  string
+	grace time.Duration
+
+	mu    sync.Mutex
+	files map[string]stateEntry
+	dirty bool
+}
+
+type stateEntry struct {
+	DstDir      string    `json:"dst_dir"`
+	SrcSize     int64     `json:"src_size"`
+	SrcModified time.Time `json:"src_modified"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+type stateFile struct {
+	Version int                   `json:"version"`
+	Files   map[string]stateEntry `json:"files"`
+}
+
+// loadState 读取状态文件，文件不存在时返回空状态。
+func loadState(path string, grace time.Duration) (*syncState, error) {
+	st := &syncState{path: path, grace: grace, files: make(map[string]stateEntry)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, fmt.Errorf("read state file: %w", err)
+	}
+	var f stateFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return st, fmt.Errorf("parse state file: %w", err)
+	}
+	if f.Version != stateVersion {
+		return st, fmt.Errorf("unsupported state file version %d", f.Version)
+	}
+	if f.Files != nil {
+		st.files = f.Files
+	}
+	return st, nil
+}
+
+// filterPlan 去掉宽限期内已提交、且源文件大小和修改时间都没有变化的计划项；
+// 同时清理过期的记录，以及已不在计划中（目标已是最新）的记录。
+func (st *syncState) filterPlan(cfg Config, plan []copyPlanItem, now time.Time, logger *Logger) ([]copyPlanItem, int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	inPlan := make(map[string]struct{}, len(plan))
+	kept := plan[:0]
+	suppressed := 0
+	for _, item := range plan {
+		src := joinRootWithRel(cfg.SrcDir, item.RelPath)
+		inPlan[src] = struct{}{}
+		e, ok := st.files[src]
+		if ok && now.Sub(e.SubmittedAt) < st.grace && e.SrcSize == item.SrcSize && e.SrcModified.Equal(item.SrcModified) {
+			logger.Info("skip recently submitted", F("src", src), F("dst", e.DstDir), F("rel_path", item.RelPath), F("submitted_at", e.SubmittedAt.Format(time.RFC3339)))
+			suppressed++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	for src, e := range st.files {
+		if _, ok := inPlan[src]; !ok || now.Sub(e.SubmittedAt) >= st.grace {
+			delete(st.files, src)
+			st.dirty = true
+		}
+	}
+	return kept, suppressed
+}
+
+// record 记录一次成功提交（或已有相同的未完成任务）。
+func (st *syncState) record(src, dstDir string, item copyPlanItem, now time.Time) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if e, ok := st.files[src]; ok && e.DstDir == dstDir && e.SrcSize == item.SrcSize && e.SrcModified.Equal(item.SrcModified) {
+		// 同一版本的文件不刷新提交时间，避免宽限期被不断延长。
+		return
+	}
+	st.files[src] = stateEntry{DstDir: dstDir, SrcSize: item.SrcSize, SrcModified: item.SrcModified, SubmittedAt: now}
+	st.dirty = true
+}
+
+// forget 删除记录，用于等待模式下最终失败的任务，使下次运行可以重新提交。
+func (st *syncState) forget(src string) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, ok := st.files[src]; ok {
+		delete(st.files, src)
+		st.dirty = true
+	}
+}
+
+// save 在有变化时把状态写回文件。
+func (st *syncState) save() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.dirty {
+		return nil
+	}
+	b, err := json.MarshalIndent(stateFile{Version: stateVersion, Files: st.files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(st.path, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	st.dirty = false
+	return nil
+}
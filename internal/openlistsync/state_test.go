@@ -0,0 +1,100 @@
+package openlistsync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunStateSuppressesResubmit(t *testing.T) {
+	mod := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := newFakeOpenList(t, map[string][]fsObj{
+		"/src": {{Name: "a.txt", Size: 10, Modified: mod}, {Name: "b.txt", Size: 20, Modified: mod}},
+		"/dst": {{Name: "b.txt", Size: 20}},
+	})
+	cfg := f.config()
+	cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+
+	if _, err := RunWithResult(context.Background(), cfg); err != nil {
+		t.Fatalf("first run error: %v", err)
+	}
+	if n := f.callCount("/api/fs/copy"); n != 1 {
+		t.Fatalf("copy calls = %d, want 1", n)
+	}
+
+	// 目标列表仍是旧内容（复制刚完成或列目录有延迟），不应重复提交。
+	res, err := RunWithResult(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("second run error: %v", err)
+	}
+	if n := f.callCount("/api/fs/copy"); n != 1 {
+		t.Fatalf("copy calls = %d, want still 1", n)
+	}
+	if res.Scan.RecentlySubmitted != 1 || len(res.Items) != 0 {
+		t.Fatalf("scan = %+v items = %d, want a.txt skipped", res.Scan, len(res.Items))
+	}
+
+	// 源文件再次变化时重新提交。
+	f.mu.Lock()
+	f.dirs["/src"][0].Size = 11
+	f.mu.Unlock()
+	if _, err := RunWithResult(context.Background(), cfg); err != nil {
+		t.Fatalf("third run error: %v", err)
+	}
+	if n := f.callCount("/api/fs/copy"); n != 2 {
+		t.Fatalf("copy calls = %d, want 2 after source changed", n)
+	}
+
+	// 目标已是最新时清理记录。
+	f.mu.Lock()
+	f.dirs["/dst"] = append(f.dirs["/dst"], fsObj{Name: "a.txt", Size: 11})
+	f.mu.Unlock()
+	if _, err := RunWithResult(context.Background(), cfg); err != nil {
+		t.Fatalf("fourth run error: %v", err)
+	}
+	st, err := loadState(cfg.StateFile, cfg.StateGrace)
+	if err != nil {
+		t.Fatalf("loadState error: %v", err)
+	}
+	if len(st.files) != 0 {
+		t.Fatalf("state files = %v, want empty after target caught up", st.files)
+	}
+}
+
+func TestStateFilterPlanGrace(t *testing.T) {
+	now := time.Now()
+	st := &syncState{grace: time.Hour, files: map[string]stateEntry{
+		"/src/old.txt":   {DstDir: "/dst", SrcSize: 1, SubmittedAt: now.Add(-2 * time.Hour)},
+		"/src/new.txt":   {DstDir: "/dst", SrcSize: 1, SubmittedAt: now.Add(-time.Minute)},
+		"/src/gone.txt":  {DstDir: "/dst", SrcSize: 1, SubmittedAt: now.Add(-time.Minute)},
+		"/src/grown.txt": {DstDir: "/dst", SrcSize: 1, SubmittedAt: now.Add(-time.Minute)},
+	}}
+	plan := []copyPlanItem{
+		{RelPath: "old.txt", SrcSize: 1},
+		{RelPath: "new.txt", SrcSize: 1},
+		{RelPath: "grown.txt", SrcSize: 2},
+	}
+	kept, suppressed := st.filterPlan(Config{SrcDir: "/src"}, plan, now, NewLogger(nil, LogLevelError))
+	if suppressed != 1 || len(kept) != 2 || kept[0].RelPath != "old.txt" || kept[1].RelPath != "grown.txt" {
+		t.Fatalf("kept = %+v suppressed = %d, want old.txt and grown.txt kept", kept, suppressed)
+	}
+	if _, ok := st.files["/src/old.txt"]; ok {
+		t.Fatalf("expired entry not pruned")
+	}
+	if _, ok := st.files["/src/gone.txt"]; ok {
+		t.Fatalf("entry not in plan not pruned")
+	}
+}
+
+func TestLoadStateCorrupt(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(p, []byte("{"), 0o644); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	st, err := loadState(p, time.Hour)
+	if err == nil || st == nil || len(st.files) != 0 {
+		t.Fatalf("loadState = %v, %v; want empty state with error", st, err)
+	}
+}
@@ -0,0 +1,267 @@
+package openlistsync
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+)
+
+// submitter 负责把复制计划提交到 OpenList。
+type submitter struct {
+	cfg      Config
+	c        *apiClient
+	dirs     *dirCache
+	tasks    *undoneTaskIndex
+	tracker  *taskTracker
+	copyRoot string
+	rec      *resultRecorder
+	// state 为空时不记录提交。
+	state *syncState
+}
+
+// copyBatch 为同一 (源父目录, 输出父目录) 下的一组待复制文件，对应一次 /api/fs/copy 请求。
+type copyBatch struct {
+	SrcDir string
+	DstDir string
+	Items  []copyPlanItem
+}
+
+type submitCounts struct {
+	submitted  int
+	skippedDup int
+	failed     int
+}
+
+func (a *submitCounts) add(b submitCounts) {
+	a.submitted += b.submitted
+	a.skippedDup += b.skippedDup
+	a.failed += b.failed
+}
+
+// buildCopyBatches 按 (源父目录, 输出父目录) 分组，每组最多 maxSize 个文件。
+// 分组顺序与 plan 中首次出现的顺序一致。
+func buildCopyBatches(plan []copyPlanItem, srcRoot, copyRoot string, maxSize int) []copyBatch {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+	var batches []copyBatch
+	open := make(map[string]int)
+	for _, item := range plan {
+		srcDir := normalizeOLPath(path.Dir(joinRootWithRel(srcRoot, item.RelPath)))
+		dstDir := normalizeOLPath(path.Dir(joinRootWithRel(copyRoot, item.RelPath)))
+		key := buildTaskKey(srcDir, dstDir)
+		if i, ok := open[key]; ok && len(batches[i].Items) < maxSize {
+			batches[i].Items = append(batches[i].Items, item)
+			continue
+		}
+		open[key] = len(batches)
+		batches = append(batches, copyBatch{SrcDir: srcDir, DstDir: dstDir, Items: []copyPlanItem{item}})
+	}
+	return batches
+}
+
+// submitPlan 把复制计划分批后，使用 cfg.SubmitConcurrency 个 worker 并发提交。
+func (s *submitter) submitPlan(ctx context.Context, plan []copyPlanItem) (submitted, skippedDup, failed int) {
+	batches := buildCopyBatches(plan, s.cfg.SrcDir, s.copyRoot, s.cfg.CopyBatchSize)
+	s.cfg.Logger.Debug("copy plan grouped", F("batches", len(batches)), F("max_batch_size", s.cfg.CopyBatchSize))
+
+	ch := make(chan copyBatch)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var total submitCounts
+	processed := 0
+	for i := 0; i < s.cfg.SubmitConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range ch {
+				counts := s.submitBatch(ctx, b)
+				mu.Lock()
+				total.add(counts)
+				processed += len(b.Items)
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, b := range batches {
+		select {
+		case ch <- b:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(ch)
+	wg.Wait()
+
+	if rest := len(plan) - processed; rest > 0 {
+		total.failed += rest
+		s.cfg.Logger.Error("submit canceled", F("not_submitted", rest), F("error", ctx.Err()))
+		s.rec.failPending(fmt.Errorf("not submitted: %w", ctx.Err()))
+	}
+	return total.submitted, total.skippedDup, total.failed
+}
+
+// submitBatch 提交一批文件：先确保输出目录存在并排除已有相同未完成任务的文件，
+// 再一次性提交复制；整批失败时逐个重试，避免单个文件阻塞同批其他文件。
+// 整批请求失败时 OpenList 可能已经为部分文件创建了任务，因此逐个重试前会重新拉取
+// 未完成任务列表，跳过已有任务的文件。
+func (s *submitter) submitBatch(ctx context.Context, b copyBatch) submitCounts {
+	var counts submitCounts
+	if err := s.dirs.ensureDir(ctx, s.c, b.DstDir); err != nil {
+		s.cfg.Logger.Error("mkdir failed", F("dst", b.DstDir), F("error", err))
+		for _, item := range b.Items {
+			s.rec.item(item.RelPath, ItemFailed, fmt.Errorf("mkdir %s: %w", b.DstDir, err))
+		}
+		counts.failed = len(b.Items)
+		return counts
+	}
+
+	pending := make([]copyPlanItem, 0, len(b.Items))
+	for _, item := range b.Items {
+		srcFile := joinRootWithRel(s.cfg.SrcDir, item.RelPath)
+		hasSameTask, err := s.tasks.has(ctx, srcFile, b.DstDir)
+		if err != nil {
+			s.cfg.Logger.Error("check undone task failed", F("src", srcFile), F("dst", b.DstDir), F("rel_path", item.RelPath), F("error", err))
+			s.rec.item(item.RelPath, ItemFailed, err)
+			counts.failed++
+			continue
+		}
+		if hasSameTask {
+			s.cfg.Logger.Info("skip duplicate task", F("src", srcFile), F("dst", b.DstDir), F("rel_path", item.RelPath))
+			s.rec.item(item.RelPath, ItemDuplicate, nil)
+			s.state.record(srcFile, b.DstDir, item, time.Now())
+			counts.skippedDup++
+			continue
+		}
+		pending = append(pending, item)
+	}
+	if len(pending) == 0 {
+		return counts
+	}
+
+	names := make([]string, len(pending))
+	for i, item := range pending {
+		names[i] = path.Base(item.RelPath)
+	}
+	infos, err := s.c.copyFiles(ctx, b.SrcDir, b.DstDir, names, true)
+	if err == nil {
+		for _, item := range pending {
+			s.logCopied(item, b.DstDir, infos)
+		}
+		counts.submitted += len(pending)
+		return counts
+	}
+	if len(pending) == 1 {
+		s.cfg.Logger.Error("copy failed", F("src", joinRootWithRel(s.cfg.SrcDir, pending[0].RelPath)), F("dst", b.DstDir), F("rel_path", pending[0].RelPath), F("error", err))
+		s.rec.item(pending[0].RelPath, ItemFailed, err)
+		counts.failed++
+		return counts
+	}
+
+	s.cfg.Logger.Error("batch copy failed, retry one by one", F("src", b.SrcDir), F("dst", b.DstDir), F("files", len(pending)), F("error", err))
+	s.tasks.invalidate()
+	for _, item := range pending {
+		srcFile := joinRootWithRel(s.cfg.SrcDir, item.RelPath)
+		hasSameTask, err := s.tasks.has(ctx, srcFile, b.DstDir)
+		if err != nil {
+			s.cfg.Logger.Error("check undone task failed", F("src", srcFile), F("dst", b.DstDir), F("rel_path", item.RelPath), F("error", err))
+			s.rec.item(item.RelPath, ItemFailed, err)
+			counts.failed++
+			continue
+		}
+		if hasSameTask {
+			// 整批请求虽然报错，但该文件的任务已经创建，视为已提交，不再重复提交。
+			s.cfg.Logger.Debug("task created by failed batch, skip retry", F("src", srcFile), F("dst", b.DstDir), F("rel_path", item.RelPath))
+			s.logCopied(item, b.DstDir, nil)
+			counts.submitted++
+			continue
+		}
+		infos, err := s.c.copyFiles(ctx, b.SrcDir, b.DstDir, []string{path.Base(srcFile)}, true)
+		if err != nil {
+			s.cfg.Logger.Error("copy failed", F("src", srcFile), F("dst", b.DstDir), F("rel_path", item.RelPath), F("error", err))
+			s.rec.item(item.RelPath, ItemFailed, err)
+			counts.failed++
+			continue
+		}
+		s.logCopied(item, b.DstDir, infos)
+		counts.submitted++
+	}
+	return counts
+}
+
+// logCopied 记录提交成功的文件，把任务加入未完成任务索引，并在等待模式下开始跟踪。
+func (s *submitter) logCopied(item copyPlanItem, dstDir string, infos []taskInfo) {
+	srcFile := joinRootWithRel(s.cfg.SrcDir, item.RelPath)
+	s.tasks.add(srcFile, dstDir)
+	s.tracker.track(srcFile, dstDir, infos)
+	s.rec.item(item.RelPath, ItemSubmitted, nil)
+	s.state.record(srcFile, dstDir, item, time.Now())
+	s.cfg.Logger.Info("copy", F("src", srcFile), F("dst", dstDir), F("rel_path", item.RelPath), F("reason", item.Reason))
+}
+
+// dirCache 记录已确认存在的目标目录，并保证并发 worker 对同一目录只 mkdir 一次。
+type dirCache struct {
+	mu   sync.Mutex
+	dirs map[string]*dirEntry
+}
+
+type dirEntry struct {
+	done chan struct{}
+	err  error
+}
+
+func newDirCache(known []string) *dirCache {
+	d := &dirCache{dirs: make(map[string]*dirEntry, len(known))}
+	for _, p := range known {
+		e := &dirEntry{done: make(chan struct{})}
+		close(e.done)
+		d.dirs[normalizeOLPath(p)] = e
+	}
+	return d
+}
+
+// ensureDir 在目录未知时递归创建目录。
+// 同一目录的并发调用会等待第一次 mkdir 的结果；失败的目录不缓存，后续调用会重试。
+func (d *dirCache) ensureDir(ctx context.Context, c *apiClient, absDir string) error {
+	absDir = normalizeOLPath(absDir)
+	d.mu.Lock()
+	if e, ok := d.dirs[absDir]; ok {
+		d.mu.Unlock()
+		select {
+		case <-e.done:
+			return e.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	e := &dirEntry{done: make(chan struct{})}
+	d.dirs[absDir] = e
+	d.mu.Unlock()
+
+	e.err = d.create(ctx, c, absDir)
+	if e.err != nil {
+		d.mu.Lock()
+		delete(d.dirs, absDir)
+		d.mu.Unlock()
+	}
+	close(e.done)
+	return e.err
+}
+
+func (d *dirCache) create(ctx context.Context, c *apiClient, absDir string) error {
+	parent := path.Dir(absDir)
+	if parent != absDir {
+		if err := d.ensureDir(ctx, c, parent); err != nil {
+			return err
+		}
+	}
+
+	if err := c.mkdir(ctx, absDir); err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
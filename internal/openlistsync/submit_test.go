@@ -0,0 +1,200 @@
+package openlistsync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDirCacheConcurrentEnsureDir(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	var mu sync.Mutex
+	made := make(map[string]int)
+	f.handle("/api/fs/mkdir", func(w http.ResponseWriter, r *http.Request) {
+		var req mkdirReq
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		made[req.Path]++
+		mu.Unlock()
+		writeAPIResp(w, 200, "success", nil)
+	})
+	c := f.client()
+	dirs := newDirCache([]string{"/dst"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := "/dst/a/b"
+			if i%2 == 0 {
+				p = "/dst/a/c"
+			}
+			if err := dirs.ensureDir(context.Background(), c, p); err != nil {
+				t.Errorf("ensureDir error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	want := map[string]int{"/dst/a": 1, "/dst/a/b": 1, "/dst/a/c": 1}
+	if len(made) != len(want) {
+		t.Fatalf("mkdir calls = %v, want %v", made, want)
+	}
+	for p, n := range want {
+		if made[p] != n {
+			t.Fatalf("mkdir calls = %v, want %v", made, want)
+		}
+	}
+}
+
+func TestRateLimiterSpacing(t *testing.T) {
+	l := newRateLimiter(50)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatalf("wait error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("6 requests at 50 rps took %s, want >= 100ms", elapsed)
+	}
+	if newRateLimiter(0) != nil {
+		t.Fatalf("rps=0 should disable limiter")
+	}
+}
+
+func TestSharedRateLimiterPerBaseURL(t *testing.T) {
+	a := newAPIClient(Config{BaseURL: "http://a:5244", RequestsPerSecond: 5})
+	b := newAPIClient(Config{BaseURL: "http://a:5244", RequestsPerSecond: 5})
+	other := newAPIClient(Config{BaseURL: "http://b:5244", RequestsPerSecond: 5})
+	if a.limiter == nil || a.limiter != b.limiter {
+		t.Fatalf("clients for the same base URL should share one limiter")
+	}
+	if other.limiter == a.limiter {
+		t.Fatalf("clients for different base URLs should not share a limiter")
+	}
+	if newAPIClient(Config{BaseURL: "http://a:5244"}).limiter != nil {
+		t.Fatalf("rps=0 should disable limiter")
+	}
+}
+
+func TestBuildCopyBatches(t *testing.T) {
+	plan := []copyPlanItem{
+		{RelPath: "a/1.txt"},
+		{RelPath: "a/2.txt"},
+		{RelPath: "a/3.txt"},
+		{RelPath: "b/1.txt"},
+		{RelPath: "root.txt"},
+	}
+	batches := buildCopyBatches(plan, "/src", "/out", 2)
+
+	want := []struct {
+		src, dst string
+		n        int
+	}{
+		{"/src/a", "/out/a", 2},
+		{"/src/a", "/out/a", 1},
+		{"/src/b", "/out/b", 1},
+		{"/src", "/out", 1},
+	}
+	if len(batches) != len(want) {
+		t.Fatalf("batches = %+v, want %d", batches, len(want))
+	}
+	for i, w := range want {
+		if batches[i].SrcDir != w.src || batches[i].DstDir != w.dst || len(batches[i].Items) != w.n {
+			t.Fatalf("batches[%d] = %+v, want %+v", i, batches[i], w)
+		}
+	}
+}
+
+func TestSubmitBatchFallbackOneByOne(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	var mu sync.Mutex
+	var requests [][]string
+	f.handle("/api/fs/copy", func(w http.ResponseWriter, r *http.Request) {
+		var req copyReq
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req.Names)
+		mu.Unlock()
+		for _, name := range req.Names {
+			if name == "bad.txt" {
+				writeAPIResp(w, 500, "bad file", nil)
+				return
+			}
+		}
+		writeAPIResp(w, 200, "success", nil)
+	})
+	c := f.client()
+	s := &submitter{
+		cfg:      f.config(),
+		c:        c,
+		dirs:     newDirCache([]string{"/dst"}),
+		tasks:    newUndoneTaskIndex(c, "/", 0),
+		copyRoot: "/dst",
+	}
+
+	counts := s.submitBatch(context.Background(), copyBatch{
+		SrcDir: "/src",
+		DstDir: "/dst",
+		Items:  []copyPlanItem{{RelPath: "a.txt"}, {RelPath: "bad.txt"}, {RelPath: "c.txt"}},
+	})
+	if counts.submitted != 2 || counts.failed != 1 {
+		t.Fatalf("counts = %+v, want submitted=2 failed=1", counts)
+	}
+	if len(requests) != 4 || len(requests[0]) != 3 {
+		t.Fatalf("copy requests = %v, want one batch then three single retries", requests)
+	}
+}
+
+func TestSubmitBatchFallbackSkipsAcceptedFiles(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	var mu sync.Mutex
+	var requests [][]string
+	var undone []taskInfo
+	f.handle("/api/fs/copy", func(w http.ResponseWriter, r *http.Request) {
+		var req copyReq
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, req.Names)
+		// 模拟 OpenList 在遇到 bad.txt 前已为 a.txt 创建任务，随后整批报错。
+		for _, name := range req.Names {
+			if name == "bad.txt" {
+				writeAPIResp(w, 500, "bad file", nil)
+				return
+			}
+			undone = append(undone, taskInfo{ID: name, Name: "copy [/src](" + name + ") to [/dst](/)"})
+		}
+		writeAPIResp(w, 200, "success", nil)
+	})
+	f.handle("/api/task/copy/undone", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		writeAPIResp(w, 200, "success", undone)
+	})
+	c := f.client()
+	s := &submitter{
+		cfg:      f.config(),
+		c:        c,
+		dirs:     newDirCache([]string{"/dst"}),
+		tasks:    newUndoneTaskIndex(c, "/", 0),
+		copyRoot: "/dst",
+	}
+
+	counts := s.submitBatch(context.Background(), copyBatch{
+		SrcDir: "/src",
+		DstDir: "/dst",
+		Items:  []copyPlanItem{{RelPath: "a.txt"}, {RelPath: "bad.txt"}, {RelPath: "c.txt"}},
+	})
+	if counts.submitted != 2 || counts.failed != 1 {
+		t.Fatalf("counts = %+v, want submitted=2 failed=1", counts)
+	}
+	if len(requests) != 3 || requests[1][0] != "bad.txt" || requests[2][0] != "c.txt" {
+		t.Fatalf("copy requests = %v, want batch, bad.txt, c.txt (a.txt not resubmitted)", requests)
+	}
+}
@@ -4,252 +4,682 @@ import (
 	"context"
 	"fmt"
 	"path"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 type treeSnapshot struct {
-	Files map[string]int64
+	Files map[string]fileMeta
 	Dirs  map[string]struct{}
+	// Filtered 记录直接包含被黑名单过滤条目的目录。
+	Filtered map[string]struct{}
+	// Ignores 为扫描时读取的忽略文件规则，Excluded 为被属性过滤排除的文件及原因，
+	// 都只在源目录扫描中填充。
+	Ignores  []ignoreLayer
+	Excluded map[string]ExcludeReason
+}
+
+// fileMeta 为比对所需的文件元信息。
+type fileMeta struct {
+	Size     int64
+	Modified time.Time
+	// Hashes 为存储提供的 hash（算法名 -> 小写十六进制），可能为空。
+	Hashes map[string]string
+}
+
+// planOptions 为生成复制计划时的比对规则。
+type planOptions struct {
+	MinSizeDiff int64
+	Policy      OverwritePolicy
+	Compare     CompareMode
+}
+
+// planStats 为生成复制计划时的统计。
+type planStats struct {
+	Unchanged int
+	// ByHash / BySize 为同名文件中按 hash 比对和按 OverwritePolicy 比对的数量。
+	ByHash int
+	BySize int
+	// RecentlySubmitted 为因状态文件中的近期提交记录而跳过的文件数。
+	RecentlySubmitted int
 }
 
 type copyPlanItem struct {
-	RelPath string
-	SrcSize int64
-	DstSize int64
-	Reason  string
+	RelPath     string
+	SrcSize     int64
+	SrcModified time.Time
+	DstSize     int64
+	Reason      string
 }
 
 // Run 执行一次目录增量同步。
 func Run(ctx context.Context, cfg Config) error {
-	cfg, err := normalizeConfig(cfg)
-	if err != nil {
-		return err
+	_, err := RunWithResult(ctx, cfg)
+	return err
+}
+
+// RunWithResult 执行一次目录增量同步并返回运行结果。
+// 出错时同样返回已得到的部分结果；配置了 ReportFile 时把结果写入该文件。
+func RunWithResult(ctx context.Context, cfg Config) (*Result, error) {
+	res := &Result{Job: strings.TrimSpace(cfg.Name), StartedAt: time.Now()}
+	rec := newResultRecorder(res)
+	rec.progress = cfg.Progress
+	reportFile := strings.TrimSpace(cfg.ReportFile)
+
+	logger := cfg.Logger
+	normalized, err := normalizeConfig(cfg)
+	if err == nil {
+		logger = normalized.Logger
+		res.Config = newResultConfig(normalized)
+		err = run(ctx, normalized, rec)
+	}
+	rec.finish(err)
+
+	if reportFile != "" {
+		if werr := writeReport(reportFile, res); werr != nil {
+			logger.Error("write report file failed", F("path", reportFile), F("error", werr))
+		} else {
+			logger.Debug("report written", F("path", reportFile))
+		}
 	}
-	filter, err := newPathFilter(cfg.Blacklist)
+	return res, err
+}
+
+func run(ctx context.Context, cfg Config, rec *resultRecorder) error {
+	filter, err := newPathFilter(cfg.Blacklist, cfg.Include)
 	if err != nil {
 		return err
 	}
+	filter.attrs = newAttrFilter(cfg, time.Now())
 	c := newAPIClient(cfg)
 	if filter.count() > 0 {
-		cfg.Logger.Infof("blacklist enabled with %d pattern(s)", filter.count())
+		cfg.Logger.Info("blacklist enabled", F("patterns", filter.count()))
+	}
+	if filter.includeCount() > 0 {
+		cfg.Logger.Info("include enabled", F("patterns", filter.includeCount()))
+	}
+	if filter.attrs != nil {
+		var fields []Field
+		if cfg.MinFileSize > 0 {
+			fields = append(fields, F("min_file_size", cfg.MinFileSize))
+		}
+		if cfg.MaxFileSize > 0 {
+			fields = append(fields, F("max_file_size", cfg.MaxFileSize))
+		}
+		if cfg.MinAge > 0 {
+			fields = append(fields, F("min_age", cfg.MinAge))
+		}
+		if !cfg.ModifiedAfter.IsZero() {
+			fields = append(fields, F("modified_after", cfg.ModifiedAfter.Format(time.RFC3339)))
+		}
+		if len(cfg.FileTypes) > 0 {
+			fields = append(fields, F("file_types", strings.Join(cfg.FileTypes, ",")))
+		}
+		cfg.Logger.Info("file filters enabled", fields...)
 	}
 	minSizeDiffBytes := cfg.MinSizeDiff * 1024
 	if cfg.MinSizeDiff > 0 {
-		cfg.Logger.Infof("min size diff enabled: %d KiB (%d bytes)", cfg.MinSizeDiff, minSizeDiffBytes)
+		cfg.Logger.Info("min size diff enabled", F("kib", cfg.MinSizeDiff), F("bytes", minSizeDiffBytes))
+	}
+	if cfg.OverwritePolicy != OverwriteLarger {
+		cfg.Logger.Info("overwrite policy", F("policy", cfg.OverwritePolicy))
+	}
+	if cfg.Compare == CompareHash {
+		cfg.Logger.Info("hash compare enabled", F("fallback_policy", cfg.OverwritePolicy))
 	}
 	if cfg.OutputDir != cfg.DstDir {
-		cfg.Logger.Infof("copy output enabled: compare dst=%s, copy output=%s", cfg.DstDir, cfg.OutputDir)
+		cfg.Logger.Info("copy output enabled", F("dst", cfg.DstDir), F("output", cfg.OutputDir))
 	}
+	if cfg.Mirror {
+		cfg.Logger.Info("mirror enabled", F("max_delete", cfg.MaxDelete), F("max_delete_ratio", cfg.MaxDeleteRatio))
+	}
+
+	rec.phase(PhaseScanning)
+	// 源和目标同时扫描；源扫描失败时取消目标扫描。
+	scanCtx, cancelScan := context.WithCancel(ctx)
+	defer cancelScan()
+	var dstSnap *treeSnapshot
+	var dstErr error
+	var scanWG sync.WaitGroup
+	scanWG.Add(1)
+	go func() {
+		defer scanWG.Done()
+		cfg.Logger.Info("scan target", F("dst", cfg.DstDir))
+		dstSnap, dstErr = scanTree(scanCtx, c, cfg.DstDir, filter, false, cfg.Logger, cfg.ScanConcurrency)
+	}()
 
-	cfg.Logger.Infof("scan source: %s", cfg.SrcDir)
-	srcSnap, err := scanTree(ctx, c, cfg.SrcDir, filter, cfg.Logger)
+	cfg.Logger.Info("scan source", F("src", cfg.SrcDir), F("concurrency", cfg.ScanConcurrency))
+	srcSnap, err := scanTree(scanCtx, c, cfg.SrcDir, filter, true, cfg.Logger, cfg.ScanConcurrency)
 	if err != nil {
-		cfg.Logger.Errorf("scan source failed: %v", err)
+		cancelScan()
+		scanWG.Wait()
+		cfg.Logger.Error("scan source failed", F("src", cfg.SrcDir), F("error", err))
 		return fmt.Errorf("scan source failed: %w", err)
 	}
+	scanWG.Wait()
 
-	cfg.Logger.Infof("scan target: %s", cfg.DstDir)
-	dstSnap, err := scanTree(ctx, c, cfg.DstDir, filter, cfg.Logger)
-	if err != nil {
-		if isNotFoundErr(err) {
+	if err := dstErr; err != nil {
+		if IsNotFound(err) {
 			if cfg.OutputDir == cfg.DstDir {
-				cfg.Logger.Infof("target dir not found, create: %s", cfg.DstDir)
+				cfg.Logger.Info("target dir not found, create", F("dst", cfg.DstDir))
 				if err := c.mkdir(ctx, cfg.DstDir); err != nil {
-					cfg.Logger.Errorf("create target dir failed: %v", err)
+					cfg.Logger.Error("create target dir failed", F("dst", cfg.DstDir), F("error", err))
 					return fmt.Errorf("create target dir failed: %w", err)
 				}
 			} else {
-				cfg.Logger.Infof("compare dst not found, treat as empty: %s", cfg.DstDir)
+				cfg.Logger.Info("compare dst not found, treat as empty", F("dst", cfg.DstDir))
 			}
 			dstSnap = &treeSnapshot{
-				Files: map[string]int64{},
-				Dirs:  map[string]struct{}{"": {}},
+				Files:    map[string]fileMeta{},
+				Dirs:     map[string]struct{}{"": {}},
+				Filtered: map[string]struct{}{},
 			}
 		} else {
-			cfg.Logger.Errorf("scan target failed: %v", err)
+			cfg.Logger.Error("scan target failed", F("dst", cfg.DstDir), F("error", err))
 			return fmt.Errorf("scan target failed: %w", err)
 		}
 	}
+	if len(srcSnap.Ignores) > 0 {
+		// 目标与源同时扫描，此时才能把源中忽略文件的规则应用到目标上。
+		cfg.Logger.Info("ignore files loaded", F("files", len(srcSnap.Ignores)))
+		applyIgnores(dstSnap, filter, srcSnap.Ignores)
+	}
+	if len(srcSnap.Excluded) > 0 {
+		ex := countExcluded(srcSnap.Excluded)
+		cfg.Logger.Info("excluded by file filters", F("too_small", ex.TooSmall), F("too_large", ex.TooLarge),
+			F("too_new", ex.TooNew), F("too_old", ex.TooOld), F("type", ex.Type))
+		protectExcluded(dstSnap, srcSnap.Excluded)
+	}
+
+	plan, stats := buildPlan(srcSnap.Files, dstSnap.Files, planOptions{
+		MinSizeDiff: minSizeDiffBytes,
+		Policy:      cfg.OverwritePolicy,
+		Compare:     cfg.Compare,
+	})
+	var state *syncState
+	if cfg.StateFile != "" {
+		st, err := loadState(cfg.StateFile, cfg.StateGrace)
+		if err != nil {
+			cfg.Logger.Error("load state file failed, start with empty state", F("path", cfg.StateFile), F("error", err))
+		}
+		state = st
+		plan, stats.RecentlySubmitted = state.filterPlan(cfg, plan, time.Now(), cfg.Logger)
+		if !cfg.DryRun {
+			defer func() {
+				if err := state.save(); err != nil {
+					cfg.Logger.Error("write state file failed", F("path", cfg.StateFile), F("error", err))
+				}
+			}()
+		}
+	}
+	rec.setScan(srcSnap, dstSnap, stats)
+	cfg.Logger.Info("scan finished", F("source_files", len(srcSnap.Files)), F("target_files", len(dstSnap.Files)))
+	cfg.Logger.Info("plan", F("to_copy", len(plan)), F("unchanged", stats.Unchanged))
+	if stats.RecentlySubmitted > 0 {
+		cfg.Logger.Info("skipped recently submitted", F("files", stats.RecentlySubmitted), F("grace", cfg.StateGrace))
+	}
+	if cfg.Compare == CompareHash {
+		cfg.Logger.Info("compare summary", F("by_hash", stats.ByHash), F("by_size", stats.BySize), F("fallback_policy", cfg.OverwritePolicy))
+	}
+
+	var deletePlan []deletePlanItem
+	if cfg.Mirror {
+		deletePlan = buildDeletePlan(srcSnap, dstSnap)
+		deleteFiles, err := checkDeleteLimits(deletePlan, len(dstSnap.Files), cfg.MaxDelete, cfg.MaxDeleteRatio)
+		if err != nil {
+			cfg.Logger.Error("mirror plan rejected", F("to_delete", len(deletePlan)), F("error", err))
+			return err
+		}
+		cfg.Logger.Info("mirror plan", F("to_delete", len(deletePlan)), F("files", deleteFiles))
+	}
 
-	plan, unchanged := buildPlan(srcSnap.Files, dstSnap.Files, minSizeDiffBytes)
-	cfg.Logger.Infof("source files: %d, target files: %d", len(srcSnap.Files), len(dstSnap.Files))
-	cfg.Logger.Infof("to copy: %d, unchanged/skipped: %d", len(plan), unchanged)
+	rec.setPlan(cfg, plan, deletePlan)
 
-	if len(plan) == 0 {
-		cfg.Logger.Infof("nothing to sync")
+	if len(plan) == 0 && len(deletePlan) == 0 {
+		cfg.Logger.Info("nothing to sync")
 		return nil
 	}
 	for _, item := range plan {
-		cfg.Logger.Debugf("PLAN %s | src=%d dst=%d | %s", item.RelPath, item.SrcSize, item.DstSize, item.Reason)
+		cfg.Logger.Debug("PLAN copy", F("rel_path", item.RelPath), F("src_size", item.SrcSize), F("dst_size", item.DstSize), F("reason", item.Reason))
+	}
+	for _, item := range deletePlan {
+		if item.IsDir {
+			cfg.Logger.Debug("PLAN delete dir", F("rel_path", item.RelPath+"/"), F("files", item.Files), F("reason", "not in source"))
+			continue
+		}
+		cfg.Logger.Debug("PLAN delete", F("rel_path", item.RelPath), F("reason", "not in source"))
 	}
 	if cfg.DryRun {
-		cfg.Logger.Infof("dry-run enabled, no copy submitted")
+		cfg.Logger.Info("dry-run enabled, no copy or delete submitted")
 		return nil
 	}
 
 	copyRoot := cfg.OutputDir
-	knownDstDirs := map[string]struct{}{copyRoot: {}}
+	knownDstDirs := []string{copyRoot}
+	conflicts := map[string]struct{}{}
 	// output 未单独指定时，可复用目标目录快照，减少重复 mkdir
 	if copyRoot == cfg.DstDir {
+		conflicts = typeConflicts(srcSnap, dstSnap)
 		for relDir := range dstSnap.Dirs {
-			knownDstDirs[joinRootWithRel(cfg.DstDir, relDir)] = struct{}{}
+			if _, ok := conflictOf(relDir, conflicts); ok {
+				continue
+			}
+			knownDstDirs = append(knownDstDirs, joinRootWithRel(cfg.DstDir, relDir))
 		}
 	}
 
-	var submitted, skippedDup, failed int
+	// 一侧是文件、另一侧是目录的路径：镜像模式下先删除目标中的旧条目再复制；
+	// 删除不了（未开启镜像、条目被过滤规则保留或删除失败）时，相关复制直接记为失败。
+	var swapDeletes []deletePlanItem
+	swapDeletes, deletePlan = splitSwapDeletes(deletePlan, conflicts)
+	var deleted, deleteFailed int
+	if len(swapDeletes) > 0 {
+		rec.phase(PhaseDeleting)
+		for _, item := range swapDeletes {
+			d, f := deleteExtraneous(ctx, c, cfg.DstDir, []deletePlanItem{item}, cfg.Logger, rec)
+			deleted += d
+			deleteFailed += f
+			if f == 0 {
+				delete(conflicts, item.RelPath)
+			}
+		}
+	}
+	blocked := 0
+	if len(conflicts) > 0 {
+		kept := make([]copyPlanItem, 0, len(plan))
+		for _, item := range plan {
+			p, ok := conflictOf(item.RelPath, conflicts)
+			if !ok {
+				kept = append(kept, item)
+				continue
+			}
+			err := fmt.Errorf("type conflict: %s is a file on one side and a directory on the other", joinRootWithRel(cfg.DstDir, p))
+			cfg.Logger.Error("copy skipped", F("rel_path", item.RelPath), F("error", err))
+			rec.item(item.RelPath, ItemFailed, err)
+			blocked++
+		}
+		plan = kept
+	}
+
 	userBasePath := "/"
 	if v, err := c.getCurrentUserBasePath(ctx); err != nil {
-		cfg.Logger.Debugf("get current user base_path failed, fallback to /: %v", err)
+		cfg.Logger.Debug("get current user base_path failed, fallback to /", F("error", err))
 	} else {
 		userBasePath = v
-		cfg.Logger.Debugf("current user base_path: %s", userBasePath)
+		cfg.Logger.Debug("current user base_path", F("base_path", userBasePath))
 	}
 
-	for _, item := range plan {
-		srcFile := joinRootWithRel(cfg.SrcDir, item.RelPath)
-		outputFile := joinRootWithRel(copyRoot, item.RelPath)
-		outputParent := normalizeOLPath(path.Dir(outputFile))
-
-		if err := ensureDir(ctx, c, outputParent, knownDstDirs); err != nil {
-			failed++
-			cfg.Logger.Errorf("mkdir failed %s: %v", outputParent, err)
-			continue
+	rec.phase(PhaseSubmitting)
+	s := &submitter{
+		cfg:      cfg,
+		c:        c,
+		dirs:     newDirCache(knownDstDirs),
+		tasks:    newUndoneTaskIndex(c, userBasePath, cfg.TaskRefreshInterval),
+		copyRoot: copyRoot,
+		rec:      rec,
+		state:    state,
+	}
+	if (cfg.Wait || cfg.TaskRetries > 0) && len(plan) > 0 {
+		s.tracker = newTaskTracker(c, userBasePath)
+		s.tracker.maxRetries = cfg.TaskRetries
+		s.tracker.backoff = cfg.TaskRetryBackoff
+		if err := s.tracker.snapshotExisting(ctx); err != nil {
+			cfg.Logger.Error("list existing copy tasks failed, tasks without id may be matched by name only", F("error", err))
 		}
+	}
+	submitted, skippedDup, failed := s.submitPlan(ctx, plan)
+	failed += blocked
 
-		hasSameTask, err := c.hasSameUndoneCopyTask(ctx, srcFile, outputParent, userBasePath)
-		if err != nil {
-			failed++
-			cfg.Logger.Errorf("check undone task failed %s -> %s: %v", srcFile, outputParent, err)
-			continue
-		}
-		if hasSameTask {
-			skippedDup++
-			cfg.Logger.Infof("skip duplicate task %s -> %s", srcFile, outputParent)
-			continue
+	var taskErr error
+	if s.tracker.count() > 0 {
+		rec.phase(PhaseWaiting)
+		taskErr = waitTasks(ctx, s.tracker, cfg.WaitInterval, cfg.WaitTimeout, cfg.Logger).err()
+		for _, task := range s.tracker.snapshot() {
+			if task.Outcome != taskOutcomeSucceeded {
+				state.forget(task.SrcFile)
+			}
 		}
+		rec.tasks(s.tracker.snapshot())
+	}
 
-		srcParent := normalizeOLPath(path.Dir(srcFile))
-		name := path.Base(srcFile)
-		if err := c.copyFile(ctx, srcParent, outputParent, name, true); err != nil {
-			failed++
-			cfg.Logger.Errorf("copy failed %s -> %s: %v", srcFile, outputParent, err)
-			continue
+	if len(deletePlan) > 0 {
+		reason := mirrorDeleteBlocker(ctx, failed+deleteFailed, taskErr, submitted, skippedDup, stats.RecentlySubmitted, s.tracker != nil)
+		if reason != "" {
+			cfg.Logger.Info("mirror deletes skipped", F("reason", reason), F("to_delete", len(deletePlan)))
+		} else {
+			rec.phase(PhaseDeleting)
+			d, f := deleteExtraneous(ctx, c, cfg.DstDir, deletePlan, cfg.Logger, rec)
+			deleted += d
+			deleteFailed += f
 		}
-		submitted++
-		cfg.Logger.Infof("copy %s -> %s (%s)", srcFile, outputParent, item.Reason)
+	}
+	if len(swapDeletes) > 0 || len(deletePlan) > 0 {
+		cfg.Logger.Info("mirror done", F("deleted", deleted), F("failed", deleteFailed))
+		failed += deleteFailed
 	}
 
-	cfg.Logger.Infof("done: submitted=%d skipped_duplicate_task=%d failed=%d", submitted, skippedDup, failed)
+	cfg.Logger.Info("done", F("submitted", submitted), F("skipped_duplicate_task", skippedDup), F("failed", failed))
 	if failed > 0 {
-		cfg.Logger.Errorf("sync finished with %d failed items", failed)
+		cfg.Logger.Error("sync finished with failed items", F("failed", failed))
 		return fmt.Errorf("sync finished with %d failed items", failed)
 	}
+	if taskErr != nil {
+		cfg.Logger.Error("sync finished with failed copy tasks", F("error", taskErr))
+		return taskErr
+	}
 	return nil
 }
 
 // scanTree 通过 OpenList 的 list API 递归遍历目录，构建：
-// 1) 以相对路径为 key 的文件大小索引
+// 1) 以相对路径为 key 的文件元信息索引
 // 2) 以相对路径为 key 的目录集合
-func scanTree(ctx context.Context, c *apiClient, root string, filter *pathFilter, logger *Logger) (*treeSnapshot, error) {
+// 目录由 concurrency 个 worker 并发列出；结果只与目录内容有关，与遍历顺序无关。
+// source 为 true 时（扫描源目录）读取各目录下的忽略文件，其规则作用于所在目录的子树，
+// 并按 filter.attrs 过滤文件。
+// 任一目录列出（或忽略文件读取）失败时取消其余请求并返回该错误。
+func scanTree(ctx context.Context, c *apiClient, root string, filter *pathFilter, source bool, logger *Logger, concurrency int) (*treeSnapshot, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	snap := &treeSnapshot{
-		Files: make(map[string]int64),
-		Dirs:  map[string]struct{}{"": {}},
+		Files:    make(map[string]fileMeta),
+		Dirs:     map[string]struct{}{"": {}},
+		Filtered: make(map[string]struct{}),
+		Excluded: make(map[string]ExcludeReason),
+	}
+	q := newScanQueue("")
+	// partial 记录本身不在白名单内、只保留其中匹配条目的目录（仅配置了白名单时使用）；
+	// filters 记录各目录适用的过滤器（含上级目录的忽略文件），目录处理完即删除。
+	// 父目录总是先于子目录处理，因此在 snapMu 下读写即可。
+	partial := make(map[string]struct{})
+	if filter.includeCount() > 0 {
+		partial[""] = struct{}{}
 	}
-	queue := []string{""}
+	filters := map[string]*pathFilter{"": filter}
 
-	for len(queue) > 0 {
-		relDir := queue[0]
-		queue = queue[1:]
-		absDir := joinRootWithRel(root, relDir)
-		logger.Debugf("scanning directory: %s", absDir)
+	var snapMu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				relDir, ok := q.pop()
+				if !ok {
+					return
+				}
+				absDir := joinRootWithRel(root, relDir)
+				logger.Debug("scanning directory", F("path", absDir))
 
-		entries, err := c.listAllEntries(ctx, absDir)
-		if err != nil {
-			return nil, fmt.Errorf("list %s: %w", absDir, err)
-		}
+				entries, err := c.listAllEntries(ctx, absDir)
+				if err != nil {
+					if q.fail(fmt.Errorf("list %s: %w", absDir, err)) {
+						cancel()
+					}
+					return
+				}
 
-		for _, obj := range entries {
-			relPath := obj.Name
-			if relDir != "" {
-				relPath = path.Join(relDir, obj.Name)
-			}
-			if filter.match(relPath) {
-				logger.Debugf("skip by blacklist: %s", relPath)
-				continue
-			}
-			if obj.IsDir {
-				snap.Dirs[relPath] = struct{}{}
-				queue = append(queue, relPath)
-				continue
+				snapMu.Lock()
+				dirFilter := filters[relDir]
+				delete(filters, relDir)
+				snapMu.Unlock()
+				if source {
+					if dirFilter, err = loadIgnoreFile(ctx, c, root, relDir, entries, dirFilter, snap, &snapMu); err != nil {
+						if q.fail(err) {
+							cancel()
+						}
+						return
+					}
+				}
+
+				var subDirs []string
+				snapMu.Lock()
+				for _, obj := range entries {
+					relPath := obj.Name
+					if relDir != "" {
+						relPath = path.Join(relDir, obj.Name)
+					}
+					if dirFilter.match(relPath, obj.IsDir) {
+						logger.Debug("skip by blacklist", F("rel_path", relPath))
+						snap.Filtered[relDir] = struct{}{}
+						continue
+					}
+					_, parentPartial := partial[relDir]
+					keep, included := dirFilter.include(relPath, obj.IsDir, !parentPartial)
+					if !keep {
+						logger.Debug("skip by include", F("rel_path", relPath))
+						snap.Filtered[relDir] = struct{}{}
+						continue
+					}
+					if obj.IsDir {
+						if !included {
+							partial[relPath] = struct{}{}
+						}
+						filters[relPath] = dirFilter
+						snap.Dirs[relPath] = struct{}{}
+						subDirs = append(subDirs, relPath)
+						continue
+					}
+					if source {
+						if reason := dirFilter.attrs.check(obj); reason != "" {
+							logger.Debug("skip by file filter", F("rel_path", relPath), F("reason", reason))
+							snap.Excluded[relPath] = reason
+							continue
+						}
+					}
+					snap.Files[relPath] = fileMeta{
+						Size:     obj.Size,
+						Modified: obj.Modified,
+						Hashes:   normalizeHashInfo(obj.HashInfo),
+					}
+				}
+				snapMu.Unlock()
+				q.done(subDirs)
 			}
-			snap.Files[relPath] = obj.Size
-		}
+		}()
 	}
+	wg.Wait()
 
+	if err := q.err(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return snap, nil
 }
 
+// maxIgnoreFileSize 为忽略文件的大小上限。
+const maxIgnoreFileSize = 1 << 20
+
+// loadIgnoreFile 在 entries 中有忽略文件时读取并解析，返回追加了其规则的过滤器，并记录到 snap.Ignores。
+func loadIgnoreFile(ctx context.Context, c *apiClient, root, relDir string, entries []fsObj, filter *pathFilter, snap *treeSnapshot, snapMu *sync.Mutex) (*pathFilter, error) {
+	idx := slices.IndexFunc(entries, func(obj fsObj) bool { return !obj.IsDir && obj.Name == ignoreFileName })
+	if idx < 0 {
+		return filter, nil
+	}
+	p := joinRootWithRel(root, path.Join(relDir, ignoreFileName))
+	// 下载已按 API 请求重试；仍然失败时中止扫描，否则镜像模式可能删除本应忽略的文件。
+	data, err := c.readFile(ctx, p, maxIgnoreFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("download ignore file %s: %w", p, err)
+	}
+	patterns, err := parseIgnoreFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", p, err)
+	}
+	snapMu.Lock()
+	snap.Ignores = append(snap.Ignores, ignoreLayer{dir: relDir, patterns: patterns})
+	snapMu.Unlock()
+	return filter.withIgnoreFile(relDir, patterns), nil
+}
+
+// applyIgnores 把源中忽略文件的规则应用到另一侧（目标）的快照上：
+// 被排除的文件和目录（含其子树）从快照中移除，并像扫描时一样记录到 Filtered。
+func applyIgnores(snap *treeSnapshot, filter *pathFilter, ignores []ignoreLayer) {
+	// 字典序下上级目录总在下级目录之前，与扫描时相同：浅层规则先匹配，深层规则优先生效。
+	ignores = slices.Clone(ignores)
+	slices.SortFunc(ignores, func(a, b ignoreLayer) int { return strings.Compare(a.dir, b.dir) })
+	for _, l := range ignores {
+		filter = filter.withIgnoreFile(l.dir, l.patterns)
+	}
+
+	dirs := make([]string, 0, len(snap.Dirs))
+	for rel := range snap.Dirs {
+		dirs = append(dirs, rel)
+	}
+	// 字典序下父目录总在子目录之前。
+	sort.Strings(dirs)
+	removed := make(map[string]struct{})
+	for _, rel := range dirs {
+		if rel == "" {
+			continue
+		}
+		parent := parentRel(rel)
+		if _, ok := removed[parent]; ok {
+			removed[rel] = struct{}{}
+			delete(snap.Dirs, rel)
+			continue
+		}
+		if filter.match(rel, true) {
+			removed[rel] = struct{}{}
+			delete(snap.Dirs, rel)
+			snap.Filtered[parent] = struct{}{}
+		}
+	}
+	for rel := range snap.Files {
+		parent := parentRel(rel)
+		if _, ok := removed[parent]; ok {
+			delete(snap.Files, rel)
+			continue
+		}
+		if filter.match(rel, false) {
+			delete(snap.Files, rel)
+			snap.Filtered[parent] = struct{}{}
+		}
+	}
+	for rel := range snap.Filtered {
+		if _, ok := removed[rel]; ok {
+			delete(snap.Filtered, rel)
+		}
+	}
+}
+
+// scanQueue 为 scanTree 的待扫描目录队列。
+// pending 统计排队中和处理中的目录数，归零即扫描完成。
+type scanQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	items   []string
+	pending int
+	failed  error
+}
+
+func newScanQueue(first string) *scanQueue {
+	q := &scanQueue{items: []string{first}, pending: 1}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// pop 取出下一个目录；扫描完成或已失败时返回 false。
+func (q *scanQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && q.pending > 0 && q.failed == nil {
+		q.cond.Wait()
+	}
+	if q.failed != nil || len(q.items) == 0 {
+		return "", false
+	}
+	item := q.items[0]
+	q.items = q.items[1:]
+	return item, true
+}
+
+// done 标记一个目录处理完成，并把其子目录加入队列。
+func (q *scanQueue) done(children []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, children...)
+	q.pending += len(children) - 1
+	q.cond.Broadcast()
+}
+
+// fail 记录第一个错误并唤醒所有 worker，返回是否为第一个错误。
+func (q *scanQueue) fail(err error) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cond.Broadcast()
+	if q.failed != nil {
+		return false
+	}
+	q.failed = err
+	return true
+}
+
+func (q *scanQueue) err() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.failed
+}
+
 // buildPlan 对比源/目标文件索引并生成复制计划。
 // 规则：
 // - 目标不存在：复制
-// - 同路径且源文件更大：覆盖复制
+// - 同路径且 opts.Compare 为 hash、两侧有同算法 hash：hash 不同时覆盖
+// - 同路径的其他情况：按 opts.Policy 判断是否覆盖（默认源文件更大时覆盖）
 // - 其他情况：跳过
-func buildPlan(srcFiles, dstFiles map[string]int64, minSizeDiff int64) ([]copyPlanItem, int) {
+func buildPlan(srcFiles, dstFiles map[string]fileMeta, opts planOptions) ([]copyPlanItem, planStats) {
 	plan := make([]copyPlanItem, 0)
-	unchanged := 0
+	var stats planStats
 
-	for rel, srcSize := range srcFiles {
-		dstSize, ok := dstFiles[rel]
+	for rel, src := range srcFiles {
+		dst, ok := dstFiles[rel]
 		if !ok {
 			plan = append(plan, copyPlanItem{
-				RelPath: rel,
-				SrcSize: srcSize,
-				DstSize: -1,
-				Reason:  "target missing",
+				RelPath:     rel,
+				SrcSize:     src.Size,
+				SrcModified: src.Modified,
+				DstSize:     -1,
+				Reason:      "target missing",
 			})
 			continue
 		}
-		diff := srcSize - dstSize
-		if diff > 0 && diff >= minSizeDiff {
+
+		var overwrite bool
+		var reason string
+		if algo, sv, dv, ok := commonHash(src.Hashes, dst.Hashes); ok && opts.Compare == CompareHash {
+			stats.ByHash++
+			if sv != dv {
+				overwrite, reason = true, fmt.Sprintf("%s differs, overwrite", algo)
+			}
+		} else {
+			if opts.Compare == CompareHash {
+				stats.BySize++
+			}
+			overwrite, reason = shouldOverwrite(opts.Policy, src, dst, opts.MinSizeDiff)
+		}
+		if overwrite {
 			plan = append(plan, copyPlanItem{
-				RelPath: rel,
-				SrcSize: srcSize,
-				DstSize: dstSize,
-				Reason:  fmt.Sprintf("source larger by %d bytes, overwrite", diff),
+				RelPath:     rel,
+				SrcSize:     src.Size,
+				SrcModified: src.Modified,
+				DstSize:     dst.Size,
+				Reason:      reason,
 			})
 			continue
 		}
-		unchanged++
+		stats.Unchanged++
 	}
 
 	sort.Slice(plan, func(i, j int) bool {
 		return plan[i].RelPath < plan[j].RelPath
 	})
-	return plan, unchanged
-}
-
-// ensureDir 在目录未知时递归创建目录。
-// known 用于避免共享父目录被重复 mkdir。
-func ensureDir(ctx context.Context, c *apiClient, absDir string, known map[string]struct{}) error {
-	absDir = normalizeOLPath(absDir)
-	if _, ok := known[absDir]; ok {
-		return nil
-	}
-
-	parent := path.Dir(absDir)
-	if parent != absDir {
-		if err := ensureDir(ctx, c, parent, known); err != nil {
-			return err
-		}
-	}
-
-	if err := c.mkdir(ctx, absDir); err != nil {
-		lower := strings.ToLower(err.Error())
-		if !strings.Contains(lower, "exist") {
-			return err
-		}
-	}
-	known[absDir] = struct{}{}
-	return nil
+	return plan, stats
 }
@@ -1,6 +1,23 @@
 package openlistsync
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func sizeOnly(sizes map[string]int64) map[string]fileMeta {
+	out := make(map[string]fileMeta, len(sizes))
+	for rel, size := range sizes {
+		out[rel] = fileMeta{Size: size}
+	}
+	return out
+}
 
 func TestParseCopyTaskKey(t *testing.T) {
 	tests := []struct {
@@ -43,19 +60,19 @@ func TestParseCopyTaskKey(t *testing.T) {
 }
 
 func TestBuildPlan(t *testing.T) {
-	src := map[string]int64{
+	src := sizeOnly(map[string]int64{
 		"a.txt":     10,
 		"b.txt":     5,
 		"sub/c.txt": 8,
-	}
-	dst := map[string]int64{
+	})
+	dst := sizeOnly(map[string]int64{
 		"a.txt": 3,
 		"b.txt": 6,
-	}
+	})
 
-	plan, unchanged := buildPlan(src, dst, 0)
-	if unchanged != 1 {
-		t.Fatalf("unchanged = %d, want 1", unchanged)
+	plan, stats := buildPlan(src, dst, planOptions{})
+	if stats.Unchanged != 1 {
+		t.Fatalf("unchanged = %d, want 1", stats.Unchanged)
 	}
 	if len(plan) != 2 {
 		t.Fatalf("plan length = %d, want 2", len(plan))
@@ -69,32 +86,135 @@ func TestBuildPlan(t *testing.T) {
 }
 
 func TestBuildPlanWithMinSizeDiff(t *testing.T) {
-	src := map[string]int64{
+	src := sizeOnly(map[string]int64{
 		"a.txt": 10,
-	}
-	dst := map[string]int64{
+	})
+	dst := sizeOnly(map[string]int64{
 		"a.txt": 7,
-	}
+	})
 
-	plan, unchanged := buildPlan(src, dst, 4)
-	if unchanged != 1 {
-		t.Fatalf("unchanged = %d, want 1", unchanged)
+	plan, stats := buildPlan(src, dst, planOptions{MinSizeDiff: 4})
+	if stats.Unchanged != 1 {
+		t.Fatalf("unchanged = %d, want 1", stats.Unchanged)
 	}
 	if len(plan) != 0 {
 		t.Fatalf("plan length = %d, want 0", len(plan))
 	}
 
-	plan, unchanged = buildPlan(src, dst, 3)
-	if unchanged != 0 {
-		t.Fatalf("unchanged = %d, want 0", unchanged)
+	plan, stats = buildPlan(src, dst, planOptions{MinSizeDiff: 3})
+	if stats.Unchanged != 0 {
+		t.Fatalf("unchanged = %d, want 0", stats.Unchanged)
 	}
 	if len(plan) != 1 {
 		t.Fatalf("plan length = %d, want 1", len(plan))
 	}
 }
 
+func TestBuildPlanOverwritePolicies(t *testing.T) {
+	base := time.Date(2026, 3, 3, 10, 0, 0, 0, time.UTC)
+	src := map[string]fileMeta{
+		"edited.txt": {Size: 10, Modified: base.Add(time.Hour)},
+		"shrunk.txt": {Size: 5, Modified: base},
+		"grown.txt":  {Size: 20, Modified: base},
+		"same.txt":   {Size: 10, Modified: base},
+	}
+	dst := map[string]fileMeta{
+		"edited.txt": {Size: 10, Modified: base},
+		"shrunk.txt": {Size: 8, Modified: base},
+		"grown.txt":  {Size: 10, Modified: base},
+		"same.txt":   {Size: 10, Modified: base.Add(time.Second)},
+	}
+
+	tests := []struct {
+		policy OverwritePolicy
+		want   map[string]string
+	}{
+		{policy: OverwriteLarger, want: map[string]string{
+			"grown.txt": "source larger by 10 bytes, overwrite",
+		}},
+		{policy: OverwriteNewer, want: map[string]string{
+			"edited.txt": "source newer by 1h0m0s, overwrite",
+		}},
+		{policy: OverwriteSizeDiffers, want: map[string]string{
+			"grown.txt":  "source larger by 10 bytes, overwrite",
+			"shrunk.txt": "source smaller by 3 bytes, overwrite",
+		}},
+		{policy: OverwriteNewerOrLarger, want: map[string]string{
+			"edited.txt": "source newer by 1h0m0s, overwrite",
+			"grown.txt":  "source larger by 10 bytes, overwrite",
+		}},
+		{policy: OverwriteAlways, want: map[string]string{
+			"edited.txt": "policy always, overwrite",
+			"grown.txt":  "policy always, overwrite",
+			"same.txt":   "policy always, overwrite",
+			"shrunk.txt": "policy always, overwrite",
+		}},
+		{policy: OverwriteNever, want: map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			plan, stats := buildPlan(src, dst, planOptions{Policy: tt.policy})
+			if len(plan) != len(tt.want) || stats.Unchanged != len(src)-len(tt.want) {
+				t.Fatalf("plan = %+v, unchanged = %d, want %v", plan, stats.Unchanged, tt.want)
+			}
+			for _, item := range plan {
+				if item.Reason != tt.want[item.RelPath] {
+					t.Fatalf("reason for %s = %q, want %q", item.RelPath, item.Reason, tt.want[item.RelPath])
+				}
+			}
+		})
+	}
+}
+
+func TestBuildPlanCompareHash(t *testing.T) {
+	src := map[string]fileMeta{
+		"same.bin":     {Size: 10, Hashes: map[string]string{"md5": "aa", "sha1": "s1"}},
+		"changed.bin":  {Size: 10, Hashes: map[string]string{"sha1": "s2"}},
+		"nohash.bin":   {Size: 12},
+		"otheralg.bin": {Size: 10, Hashes: map[string]string{"md5": "aa"}},
+	}
+	dst := map[string]fileMeta{
+		"same.bin":     {Size: 5, Hashes: map[string]string{"md5": "bb", "sha1": "s1"}},
+		"changed.bin":  {Size: 10, Hashes: map[string]string{"sha1": "s3"}},
+		"nohash.bin":   {Size: 10, Hashes: map[string]string{"md5": "aa"}},
+		"otheralg.bin": {Size: 10, Hashes: map[string]string{"sha256": "cc"}},
+	}
+
+	plan, stats := buildPlan(src, dst, planOptions{Compare: CompareHash})
+	if stats.ByHash != 2 || stats.BySize != 2 || stats.Unchanged != 2 {
+		t.Fatalf("stats = %+v, want by_hash=2 by_size=2 unchanged=2", stats)
+	}
+	if len(plan) != 2 {
+		t.Fatalf("plan = %+v, want 2 items", plan)
+	}
+	if plan[0].RelPath != "changed.bin" || plan[0].Reason != "sha1 differs, overwrite" {
+		t.Fatalf("plan[0] = %+v, unexpected", plan[0])
+	}
+	if plan[1].RelPath != "nohash.bin" || plan[1].Reason != "source larger by 2 bytes, overwrite" {
+		t.Fatalf("plan[1] = %+v, unexpected", plan[1])
+	}
+
+	_, stats = buildPlan(src, dst, planOptions{})
+	if stats.ByHash != 0 || stats.BySize != 0 {
+		t.Fatalf("stats = %+v, want no compare counters in size mode", stats)
+	}
+}
+
+func TestParseOverwritePolicy(t *testing.T) {
+	if p, err := ParseOverwritePolicy(""); err != nil || p != OverwriteLarger {
+		t.Fatalf("policy=%q err=%v, want larger", p, err)
+	}
+	if p, err := ParseOverwritePolicy(" Newer-Or-Larger "); err != nil || p != OverwriteNewerOrLarger {
+		t.Fatalf("policy=%q err=%v, want newer-or-larger", p, err)
+	}
+	if _, err := ParseOverwritePolicy("bigger"); err == nil {
+		t.Fatalf("expected invalid policy error")
+	}
+}
+
 func TestPathFilterMatch(t *testing.T) {
-	f, err := newPathFilter([]string{"*.tmp", "cache/*", "sub/ignore.txt", "node_modules"})
+	f, err := newPathFilter([]string{"*.tmp", "cache/*", "sub/ignore.txt", "node_modules"}, nil)
 	if err != nil {
 		t.Fatalf("newPathFilter error: %v", err)
 	}
@@ -112,17 +232,190 @@ func TestPathFilterMatch(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got := f.match(tt.relPath)
+		got := f.match(tt.relPath, false)
 		if got != tt.want {
 			t.Fatalf("match(%q)=%v, want=%v", tt.relPath, got, tt.want)
 		}
 	}
 }
 
+func TestPathFilterGlob(t *testing.T) {
+	f, err := newPathFilter([]string{"**/node_modules/**", "a/**/b.tmp", "/root.txt", "build/", "/logs/"}, nil)
+	if err != nil {
+		t.Fatalf("newPathFilter error: %v", err)
+	}
+
+	tests := []struct {
+		relPath string
+		isDir   bool
+		want    bool
+	}{
+		{relPath: "node_modules", isDir: true, want: true},
+		{relPath: "x/y/node_modules/pkg/index.js", want: true},
+		{relPath: "x/node_modules_old/a.js", want: false},
+		{relPath: "a/b.tmp", want: true},
+		{relPath: "a/x/y/b.tmp", want: true},
+		{relPath: "x/a/b.tmp", want: false},
+		{relPath: "root.txt", want: true},
+		{relPath: "sub/root.txt", want: false},
+		{relPath: "build", isDir: true, want: true},
+		{relPath: "sub/build", isDir: true, want: true},
+		{relPath: "build", isDir: false, want: false},
+		{relPath: "logs", isDir: true, want: true},
+		{relPath: "sub/logs", isDir: true, want: false},
+	}
+	for _, tt := range tests {
+		if got := f.match(tt.relPath, tt.isDir); got != tt.want {
+			t.Fatalf("match(%q, dir=%v)=%v, want=%v", tt.relPath, tt.isDir, got, tt.want)
+		}
+	}
+
+	// ** 模式下任何目录都可能包含白名单文件；锚定模式只遍历其前缀目录。
+	f, err = newPathFilter(nil, []string{"media/**/*.mkv", "/top.txt"})
+	if err != nil {
+		t.Fatalf("newPathFilter error: %v", err)
+	}
+	for relDir, want := range map[string]bool{"media": true, "media/a/b": true, "other": false} {
+		if keep, _ := f.include(relDir, true, false); keep != want {
+			t.Fatalf("include(%q) keep=%v, want %v", relDir, keep, want)
+		}
+	}
+	if keep, _ := f.include("media/a/b/c.mkv", false, false); !keep {
+		t.Fatalf("include(media/a/b/c.mkv) keep=false, want true")
+	}
+}
+
+func TestPathFilterNegation(t *testing.T) {
+	f, err := newPathFilter([]string{"*.tmp", "!keep/important.tmp", "!b.log", "*.log", "c.dat", "!c.dat", "c.dat"}, nil)
+	if err != nil {
+		t.Fatalf("newPathFilter error: %v", err)
+	}
+	for relPath, want := range map[string]bool{
+		"a.tmp":              true,
+		"keep/important.tmp": false,
+		"keep/other.tmp":     true,
+		"b.log":              true,
+		"c.dat":              true,
+	} {
+		if got := f.match(relPath, false); got != want {
+			t.Fatalf("match(%q)=%v, want=%v", relPath, got, want)
+		}
+	}
+
+	patterns, err := parseIgnoreFile([]byte("# comment\r\n\n*.log\n!/x.tmp\n"))
+	if err != nil {
+		t.Fatalf("parseIgnoreFile error: %v", err)
+	}
+	sub := f.withIgnoreFile("sub", patterns)
+	for relPath, want := range map[string]bool{
+		"sub/a.log":   true,
+		"sub/x.tmp":   false,
+		"sub/y/x.tmp": true,
+		"a.tmp":       true,
+		"subx/x.tmp":  true,
+	} {
+		if got := sub.match(relPath, false); got != want {
+			t.Fatalf("with ignore file: match(%q)=%v, want=%v", relPath, got, want)
+		}
+	}
+	if len(f.ignores) != 0 {
+		t.Fatalf("withIgnoreFile modified the original filter")
+	}
+
+	if _, err := parseIgnoreFile([]byte("ok\n[\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("err = %v, want line 2 error", err)
+	}
+}
+
+func TestPathFilterRegex(t *testing.T) {
+	f, err := newPathFilter([]string{`re:-sample\.(mkv|mp4)$`, `re:^tmp/\d{8}/`, `!re:^tmp/\d{8}/keep`}, []string{`re:\.(mkv|mp4)$`})
+	if err != nil {
+		t.Fatalf("newPathFilter error: %v", err)
+	}
+	for relPath, want := range map[string]bool{
+		"movies/a-sample.mkv":   true,
+		"movies/a-sample.avi":   false,
+		"movies/a.mkv":          false,
+		"tmp/20240101/x.log":    true,
+		"tmp/20240101/keep.log": false,
+		"old/tmp/20240101/x":    false,
+	} {
+		if got := f.match(relPath, false); got != want {
+			t.Fatalf("match(%q)=%v, want=%v", relPath, got, want)
+		}
+	}
+	if keep, _ := f.include("movies/a.mkv", false, false); !keep {
+		t.Fatalf("include(movies/a.mkv) keep=false, want true")
+	}
+	if keep, _ := f.include("movies/a.srt", false, false); keep {
+		t.Fatalf("include(movies/a.srt) keep=true, want false")
+	}
+	// 无法判断正则表达式能否匹配目录下的路径，目录总是继续遍历。
+	if keep, _ := f.include("any/dir", true, false); !keep {
+		t.Fatalf("include(any/dir) keep=false, want true")
+	}
+
+	_, err = newPathFilter([]string{"*.tmp", "", `re:(a|b`}, nil)
+	if err == nil || !strings.Contains(err.Error(), "blacklist[2] `re:(a|b`") || !strings.Contains(err.Error(), "missing closing )") {
+		t.Fatalf("err = %v, want error pointing at blacklist[2]", err)
+	}
+	_, err = newPathFilter(nil, []string{"re:"})
+	if err == nil || !strings.Contains(err.Error(), "include[0] `re:`") {
+		t.Fatalf("err = %v, want error pointing at include[0]", err)
+	}
+}
+
 func TestPathFilterInvalidPattern(t *testing.T) {
-	_, err := newPathFilter([]string{"["})
-	if err == nil {
-		t.Fatalf("expected invalid pattern error")
+	for _, p := range []string{"[", "a/[/b", "/"} {
+		if _, err := newPathFilter([]string{p}, nil); err == nil {
+			t.Fatalf("pattern %q: expected invalid pattern error", p)
+		}
+	}
+}
+
+func TestPathFilterInclude(t *testing.T) {
+	f, err := newPathFilter([]string{"*.tmp"}, []string{"*.mkv", "photos/2024/*", "docs"})
+	if err != nil {
+		t.Fatalf("newPathFilter error: %v", err)
+	}
+
+	tests := []struct {
+		relPath   string
+		isDir     bool
+		parentAll bool
+		keep      bool
+		all       bool
+	}{
+		{relPath: "movie.mkv", keep: true, all: true},
+		{relPath: "a/b/movie.mkv", keep: true, all: true},
+		{relPath: "a.txt", keep: false},
+		{relPath: "photos/2024/a.jpg", keep: true, all: true},
+		{relPath: "photos/2023/a.jpg", keep: false},
+		{relPath: "docs", isDir: true, keep: true, all: true},
+		{relPath: "docs/a.txt", parentAll: true, keep: true, all: true},
+		{relPath: "photos", isDir: true, keep: true},
+		{relPath: "other", isDir: true, keep: true},
+	}
+	for _, tt := range tests {
+		keep, all := f.include(tt.relPath, tt.isDir, tt.parentAll)
+		if keep != tt.keep || all != tt.all {
+			t.Fatalf("include(%q)=(%v,%v), want (%v,%v)", tt.relPath, keep, all, tt.keep, tt.all)
+		}
+	}
+
+	// 只有含 / 的模式时，不可能包含匹配文件的目录不再遍历。
+	f, err = newPathFilter(nil, []string{"photos/2024/*"})
+	if err != nil {
+		t.Fatalf("newPathFilter error: %v", err)
+	}
+	for relDir, want := range map[string]bool{"photos": true, "photos/2024": true, "photos/2023": false, "videos": false} {
+		if keep, _ := f.include(relDir, true, false); keep != want {
+			t.Fatalf("include(%q) keep=%v, want %v", relDir, keep, want)
+		}
+	}
+
+	if _, err := newPathFilter(nil, []string{"["}); err == nil {
+		t.Fatalf("expected invalid include pattern error")
 	}
 }
 
@@ -145,3 +438,429 @@ func TestBuildWantTaskKeysWithRootBasePath(t *testing.T) {
 		t.Fatalf("missing user-view key")
 	}
 }
+
+func TestBuildDeletePlan(t *testing.T) {
+	src := &treeSnapshot{
+		Files: sizeOnly(map[string]int64{"a.txt": 1, "keep/b.txt": 1}),
+		Dirs:  map[string]struct{}{"": {}, "keep": {}},
+	}
+	dst := &treeSnapshot{
+		Files: sizeOnly(map[string]int64{
+			"a.txt":           1,
+			"old.txt":         1,
+			"keep/b.txt":      1,
+			"keep/stale.txt":  1,
+			"gone/x.txt":      1,
+			"gone/sub/y.txt":  1,
+			"guarded/z.txt":   1,
+			"guarded/sub/w.c": 1,
+		}),
+		Dirs: map[string]struct{}{
+			"": {}, "keep": {}, "gone": {}, "gone/sub": {}, "guarded": {}, "guarded/sub": {},
+		},
+		Filtered: map[string]struct{}{"guarded": {}},
+	}
+
+	plan := buildDeletePlan(src, dst)
+	want := []deletePlanItem{
+		{RelPath: "gone", IsDir: true, Files: 2},
+		{RelPath: "guarded/sub", IsDir: true, Files: 1},
+		{RelPath: "guarded/z.txt", Files: 1},
+		{RelPath: "keep/stale.txt", Files: 1},
+		{RelPath: "old.txt", Files: 1},
+	}
+	if len(plan) != len(want) {
+		t.Fatalf("plan = %+v, want %+v", plan, want)
+	}
+	for i := range want {
+		if plan[i] != want[i] {
+			t.Fatalf("plan[%d] = %+v, want %+v", i, plan[i], want[i])
+		}
+	}
+}
+
+func TestCheckDeleteLimits(t *testing.T) {
+	plan := []deletePlanItem{
+		{RelPath: "dir", IsDir: true, Files: 3},
+		{RelPath: "a.txt", Files: 1},
+	}
+	if total, err := checkDeleteLimits(plan, 10, 0, 0); err != nil || total != 4 {
+		t.Fatalf("total=%d err=%v, want 4 <nil>", total, err)
+	}
+	if _, err := checkDeleteLimits(plan, 10, 3, 0); err == nil {
+		t.Fatalf("expected max_delete error")
+	}
+	if _, err := checkDeleteLimits(plan, 10, 0, 0.3); err == nil {
+		t.Fatalf("expected max_delete_ratio error")
+	}
+	if _, err := checkDeleteLimits(plan, 10, 4, 0.4); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// mirrorTestServer 模拟源中新增 new.txt、目标中多出 old.txt 的镜像场景，
+// 复制接口的返回由 copyCode 决定，并记录删除与复制请求的先后顺序。
+func mirrorTestServer(t *testing.T, dirs map[string][]fsObj, copyCode int) (*fakeOpenList, func() []string) {
+	f := newFakeOpenList(t, dirs)
+	var mu sync.Mutex
+	var calls []string
+	f.handle("/api/fs/copy", func(w http.ResponseWriter, r *http.Request) {
+		var req copyReq
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		calls = append(calls, "copy "+req.SrcDir+" -> "+req.DstDir+" "+strings.Join(req.Names, ","))
+		mu.Unlock()
+		if copyCode != 200 {
+			writeAPIResp(w, copyCode, "storage busy", nil)
+			return
+		}
+		tasks := make([]taskInfo, 0, len(req.Names))
+		for _, name := range req.Names {
+			tasks = append(tasks, taskInfo{ID: "t-" + name, Name: "copy [" + req.SrcDir + "](" + name + ") to [" + req.DstDir + "](/)"})
+		}
+		writeAPIResp(w, 200, "success", copyResp{Tasks: tasks})
+	})
+	f.handle("/api/task/copy/done", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 200, "success", []taskInfo{
+			{ID: "t-new.txt", Name: "copy [/src](new.txt) to [/dst](/)", State: taskStateSucceeded, Progress: 100},
+		})
+	})
+	f.handle("/api/fs/remove", func(w http.ResponseWriter, r *http.Request) {
+		var req removeReq
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		calls = append(calls, "remove "+req.Dir+" "+strings.Join(req.Names, ","))
+		mu.Unlock()
+		writeAPIResp(w, 200, "success", nil)
+	})
+	return f, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), calls...)
+	}
+}
+
+func TestRunMirrorDeletesOnlyAfterConfirmedCopies(t *testing.T) {
+	dirs := map[string][]fsObj{
+		"/src": {{Name: "new.txt", Size: 10}},
+		"/dst": {{Name: "old.txt", Size: 10}},
+	}
+	cases := []struct {
+		name     string
+		copyCode int
+		wait     bool
+		wantErr  bool
+		removed  bool
+	}{
+		{name: "copy failed", copyCode: 500, wait: true, wantErr: true},
+		{name: "not waited", copyCode: 200},
+		{name: "waited", copyCode: 200, wait: true, removed: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, calls := mirrorTestServer(t, dirs, tc.copyCode)
+			cfg := f.config()
+			cfg.Mirror = true
+			cfg.Wait = tc.wait
+			cfg.WaitInterval = time.Millisecond
+
+			res, err := RunWithResult(context.Background(), cfg)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if n := f.callCount("/api/fs/remove"); (n > 0) != tc.removed {
+				t.Fatalf("remove calls = %d (%v), want removed=%v", n, calls(), tc.removed)
+			}
+			if len(res.Deletes) != 1 {
+				t.Fatalf("deletes = %+v, want old.txt planned", res.Deletes)
+			}
+			want := ItemPlanned
+			if tc.removed {
+				want = ItemDeleted
+			}
+			if got := res.Deletes[0].Outcome; got != want {
+				t.Fatalf("old.txt outcome = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRunMirrorFileDirSwap(t *testing.T) {
+	// 源中 x 变成了文件、y 变成了目录，目标中仍是旧的类型。
+	dirs := map[string][]fsObj{
+		"/src":   {{Name: "x", Size: 10}, {Name: "y", IsDir: true}},
+		"/src/y": {{Name: "b.txt", Size: 5}},
+		"/dst":   {{Name: "x", IsDir: true}, {Name: "y", Size: 3}},
+		"/dst/x": {{Name: "old.txt", Size: 1}},
+	}
+	f, calls := mirrorTestServer(t, dirs, 200)
+	cfg := f.config()
+	cfg.Mirror = true
+
+	if _, err := RunWithResult(context.Background(), cfg); err != nil {
+		t.Fatalf("RunWithResult error: %v", err)
+	}
+	got := calls()
+	want := []string{"remove /dst x", "remove /dst y"}
+	if len(got) != 4 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("calls = %v, want swapped entries removed before copies", got)
+	}
+	copies := strings.Join(got[2:], "; ")
+	if !strings.Contains(copies, "copy /src -> /dst x") || !strings.Contains(copies, "copy /src/y -> /dst/y b.txt") {
+		t.Fatalf("calls = %v, want x and y/b.txt copied after the removes", got)
+	}
+	if n := f.callCount("/api/fs/mkdir"); n != 1 {
+		t.Fatalf("mkdir calls = %d, want /dst/y created after the file was removed", n)
+	}
+}
+
+func TestRunFileDirConflictWithoutMirror(t *testing.T) {
+	dirs := map[string][]fsObj{
+		"/src":   {{Name: "x", Size: 10}, {Name: "a.txt", Size: 1}},
+		"/dst":   {{Name: "x", IsDir: true}},
+		"/dst/x": {{Name: "old.txt", Size: 1}},
+	}
+	f, calls := mirrorTestServer(t, dirs, 200)
+
+	res, err := RunWithResult(context.Background(), f.config())
+	if err == nil {
+		t.Fatalf("expected error for conflicting path")
+	}
+	got := calls()
+	if len(got) != 1 || got[0] != "copy /src -> /dst a.txt" {
+		t.Fatalf("calls = %v, want only a.txt copied", got)
+	}
+	for _, item := range res.Items {
+		if item.RelPath == "x" && (item.Outcome != ItemFailed || !strings.Contains(item.Error, "type conflict")) {
+			t.Fatalf("x = %+v, want failed with type conflict", item)
+		}
+	}
+}
+
+func TestScanTreeConcurrent(t *testing.T) {
+	dirs := map[string][]fsObj{
+		"/src":       {{Name: "a.txt", Size: 1}, {Name: "d1", IsDir: true}, {Name: "d2", IsDir: true}, {Name: "x.tmp", Size: 9}},
+		"/src/d1":    {{Name: "b.txt", Size: 2}, {Name: "d3", IsDir: true}},
+		"/src/d2":    {{Name: "c.txt", Size: 3}},
+		"/src/d1/d3": {{Name: "e.txt", Size: 4}},
+	}
+	f := newFakeOpenList(t, dirs)
+	filter, err := newPathFilter([]string{"*.tmp"}, nil)
+	if err != nil {
+		t.Fatalf("newPathFilter error: %v", err)
+	}
+
+	for _, n := range []int{1, 4} {
+		snap, err := scanTree(context.Background(), f.client(), "/src", filter, false, nil, n)
+		if err != nil {
+			t.Fatalf("scanTree(concurrency=%d) error: %v", n, err)
+		}
+		wantFiles := map[string]int64{"a.txt": 1, "d1/b.txt": 2, "d2/c.txt": 3, "d1/d3/e.txt": 4}
+		if len(snap.Files) != len(wantFiles) {
+			t.Fatalf("files = %v, want %v", snap.Files, wantFiles)
+		}
+		for rel, size := range wantFiles {
+			if snap.Files[rel].Size != size {
+				t.Fatalf("files[%s] = %+v, want size %d", rel, snap.Files[rel], size)
+			}
+		}
+		if len(snap.Dirs) != 4 {
+			t.Fatalf("dirs = %v, want 4 entries", snap.Dirs)
+		}
+		if _, ok := snap.Filtered[""]; !ok {
+			t.Fatalf("filtered = %v, want root", snap.Filtered)
+		}
+	}
+}
+
+func TestScanTreeInclude(t *testing.T) {
+	dirs := map[string][]fsObj{
+		"/src":             {{Name: "a.txt", Size: 1}, {Name: "photos", IsDir: true}, {Name: "music", IsDir: true}},
+		"/src/photos":      {{Name: "2024", IsDir: true}, {Name: "2023", IsDir: true}},
+		"/src/photos/2024": {{Name: "p.jpg", Size: 2}, {Name: "p.tmp", Size: 3}},
+		"/src/music":       {{Name: "m.mp3", Size: 4}},
+	}
+	f := newFakeOpenList(t, dirs)
+	filter, err := newPathFilter([]string{"*.tmp"}, []string{"photos/2024"})
+	if err != nil {
+		t.Fatalf("newPathFilter error: %v", err)
+	}
+
+	// photos/2023 与 music 不可能包含匹配的文件，不应被列出（fake 中也没有 photos/2023）。
+	snap, err := scanTree(context.Background(), f.client(), "/src", filter, false, nil, 2)
+	if err != nil {
+		t.Fatalf("scanTree error: %v", err)
+	}
+	if len(snap.Files) != 1 || snap.Files["photos/2024/p.jpg"].Size != 2 {
+		t.Fatalf("files = %v, want only photos/2024/p.jpg", snap.Files)
+	}
+	for _, rel := range []string{"", "photos", "photos/2024"} {
+		if _, ok := snap.Filtered[rel]; !ok {
+			t.Fatalf("filtered = %v, want %q", snap.Filtered, rel)
+		}
+	}
+}
+
+func TestScanTreeIgnoreFile(t *testing.T) {
+	dirs := map[string][]fsObj{
+		"/src":     {{Name: "a.tmp", Size: 1}, {Name: "sub", IsDir: true}},
+		"/src/sub": {{Name: ignoreFileName, Size: 20}, {Name: "b.log", Size: 2}, {Name: "keep.tmp", Size: 3}, {Name: "cache", IsDir: true}},
+	}
+	f := newFakeOpenList(t, dirs)
+	f.handle("/api/fs/get", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Path string `json:"path"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		writeAPIResp(w, 200, "success", map[string]string{"raw_url": "/d" + req.Path})
+	})
+	f.handle("/d/src/sub/"+ignoreFileName, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "*.log\ncache/\n!keep.tmp\n")
+	})
+	filter, err := newPathFilter([]string{"*.tmp"}, nil)
+	if err != nil {
+		t.Fatalf("newPathFilter error: %v", err)
+	}
+
+	// sub/cache 被忽略文件排除，不应被列出（fake 中没有该目录）。
+	snap, err := scanTree(context.Background(), f.client(), "/src", filter, true, nil, 2)
+	if err != nil {
+		t.Fatalf("scanTree error: %v", err)
+	}
+	want := []string{"sub/" + ignoreFileName, "sub/keep.tmp"}
+	if len(snap.Files) != len(want) {
+		t.Fatalf("files = %v, want %v", snap.Files, want)
+	}
+	for _, rel := range want {
+		if _, ok := snap.Files[rel]; !ok {
+			t.Fatalf("files = %v, want %v", snap.Files, want)
+		}
+	}
+	if len(snap.Ignores) != 1 || snap.Ignores[0].dir != "sub" {
+		t.Fatalf("ignores = %+v, want one layer for sub", snap.Ignores)
+	}
+
+	dst := &treeSnapshot{
+		Files: map[string]fileMeta{
+			"a.txt": {}, "sub/b.log": {}, "sub/keep.tmp": {}, "sub/cache/x": {}, "other/b.log": {},
+		},
+		Dirs:     map[string]struct{}{"": {}, "sub": {}, "sub/cache": {}, "sub/cache/y": {}, "other": {}},
+		Filtered: map[string]struct{}{"sub/cache/y": {}},
+	}
+	applyIgnores(dst, filter, snap.Ignores)
+	if len(dst.Files) != 3 {
+		t.Fatalf("dst files = %v, want a.txt sub/keep.tmp other/b.log", dst.Files)
+	}
+	if _, ok := dst.Dirs["sub/cache"]; ok {
+		t.Fatalf("dst dirs = %v, want sub/cache removed", dst.Dirs)
+	}
+	if _, ok := dst.Dirs["sub/cache/y"]; ok {
+		t.Fatalf("dst dirs = %v, want sub/cache/y removed", dst.Dirs)
+	}
+	if _, ok := dst.Filtered["sub"]; !ok || len(dst.Filtered) != 1 {
+		t.Fatalf("dst filtered = %v, want only sub", dst.Filtered)
+	}
+}
+
+func TestScanTreeIgnoreFileDownloadRetry(t *testing.T) {
+	dirs := map[string][]fsObj{
+		"/src": {{Name: ignoreFileName, Size: 6}, {Name: "a.log", Size: 1}, {Name: "b.txt", Size: 1}},
+	}
+	f := newFakeOpenList(t, dirs)
+	f.handle("/api/fs/get", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 200, "success", map[string]string{"raw_url": "/d/src/" + ignoreFileName + "?sign=x"})
+	})
+	var auth []string
+	f.handle("/d/src/"+ignoreFileName, func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		if len(auth) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "*.log\n")
+	})
+	c := retryTestClient(f)
+	obs := &recordingObserver{}
+	c.observer = obs
+
+	snap, err := scanTree(context.Background(), c, "/src", nil, true, nil, 1)
+	if err != nil {
+		t.Fatalf("scanTree error: %v", err)
+	}
+	if _, ok := snap.Files["a.log"]; ok || len(snap.Files) != 2 {
+		t.Fatalf("files = %v, want a.log ignored", snap.Files)
+	}
+	if len(auth) != 2 || auth[1] != "token" {
+		t.Fatalf("raw_url requests authorization = %q, want 2 requests with token", auth)
+	}
+	if got := strings.Join(obs.observed, ","); !strings.Contains(got, "raw_url 503,raw_url 200") {
+		t.Fatalf("observed = %v, want raw_url 503 then 200", obs.observed)
+	}
+}
+
+func TestScanTreeIgnoreFileReadError(t *testing.T) {
+	dirs := map[string][]fsObj{
+		"/src": {{Name: ignoreFileName, Size: 1}},
+	}
+	f := newFakeOpenList(t, dirs)
+	f.handle("/api/fs/get", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 200, "success", map[string]string{"raw_url": "/d/missing"})
+	})
+	f.handle("/d/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	_, err := scanTree(context.Background(), f.client(), "/src", nil, true, nil, 1)
+	if err == nil || !strings.Contains(err.Error(), "download ignore file /src/"+ignoreFileName) {
+		t.Fatalf("err = %v, want download error naming the ignore file", err)
+	}
+	if n := f.callCount("/d/missing"); n != 1 {
+		t.Fatalf("raw_url calls = %d, want 1 (404 is not retried)", n)
+	}
+}
+
+func TestScanTreeError(t *testing.T) {
+	dirs := map[string][]fsObj{
+		"/src":    {{Name: "ok", IsDir: true}, {Name: "missing", IsDir: true}},
+		"/src/ok": {{Name: "a.txt", Size: 1}},
+	}
+	f := newFakeOpenList(t, dirs)
+
+	_, err := scanTree(context.Background(), f.client(), "/src", nil, false, nil, 4)
+	if err == nil || !IsNotFound(err) {
+		t.Fatalf("err = %v, want not found error", err)
+	}
+}
+
+func TestUndoneTaskIndexFetchOnce(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	f.handle("/api/task/copy/undone", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 200, "success", []taskInfo{{Name: "copy [/src](a.txt) to [/dst](/)"}})
+	})
+	idx := newUndoneTaskIndex(f.client(), "/", 0)
+
+	for i := 0; i < 5; i++ {
+		ok, err := idx.has(context.Background(), "/src/a.txt", "/dst")
+		if err != nil || !ok {
+			t.Fatalf("has(a.txt) = %v, %v, want true", ok, err)
+		}
+	}
+	if ok, _ := idx.has(context.Background(), "/src/b.txt", "/dst"); ok {
+		t.Fatalf("has(b.txt) = true, want false")
+	}
+	idx.add("/src/b.txt", "/dst")
+	if ok, _ := idx.has(context.Background(), "/src/b.txt", "/dst"); !ok {
+		t.Fatalf("has(b.txt) after add = false, want true")
+	}
+	if n := f.callCount("/api/task/copy/undone"); n != 1 {
+		t.Fatalf("undone task list calls = %d, want 1", n)
+	}
+
+	idx.refresh = time.Nanosecond
+	if _, err := idx.has(context.Background(), "/src/b.txt", "/dst"); err != nil {
+		t.Fatalf("has error: %v", err)
+	}
+	if n := f.callCount("/api/task/copy/undone"); n != 2 {
+		t.Fatalf("undone task list calls = %d, want 2 after refresh interval", n)
+	}
+}
@@ -5,31 +5,96 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 var copyTaskNameRe = regexp.MustCompile(`^copy \[(.+)\]\((.+)\) to \[(.+)\]\((.+)\)$`)
 
-// hasSameUndoneCopyTask 检查 OpenList 未完成复制任务中是否已存在等价任务，
-// 用于避免重复提交。
-func (c *apiClient) hasSameUndoneCopyTask(ctx context.Context, srcFile, dstDir, userBasePath string) (bool, error) {
-	tasks, err := c.listUndoneCopyTasks(ctx)
-	if err != nil {
-		return false, err
+// undoneTaskIndex 缓存 OpenList 未完成复制任务的 key 集合，用于避免重复提交。
+// 每次运行只拉取一次任务列表，之后仅在超过 refresh 间隔时重新拉取；
+// 本次运行提交的任务会立即加入索引，且不会因刷新而丢失。
+type undoneTaskIndex struct {
+	c            *apiClient
+	userBasePath string
+	refresh      time.Duration
+
+	mu        sync.Mutex
+	remote    map[string]struct{}
+	own       map[string]struct{}
+	fetchedAt time.Time
+}
+
+// newUndoneTaskIndex 创建任务索引，refresh <= 0 表示本次运行内不刷新。
+func newUndoneTaskIndex(c *apiClient, userBasePath string, refresh time.Duration) *undoneTaskIndex {
+	return &undoneTaskIndex{
+		c:            c,
+		userBasePath: userBasePath,
+		refresh:      refresh,
+		own:          make(map[string]struct{}),
 	}
+}
 
-	wantKeys := buildWantTaskKeys(srcFile, dstDir, userBasePath)
-	for _, t := range tasks {
-		key, ok := parseCopyTaskKey(t.Name)
-		if !ok {
-			continue
+// has 检查 OpenList 未完成复制任务中是否已存在等价任务。
+func (idx *undoneTaskIndex) has(ctx context.Context, srcFile, dstDir string) (bool, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.remote == nil || (idx.refresh > 0 && time.Since(idx.fetchedAt) >= idx.refresh) {
+		if err := idx.load(ctx); err != nil {
+			return false, err
+		}
+	}
+	for key := range buildWantTaskKeys(srcFile, dstDir, idx.userBasePath) {
+		if _, ok := idx.remote[key]; ok {
+			return true, nil
 		}
-		if _, ok := wantKeys[key]; ok {
+		if _, ok := idx.own[key]; ok {
 			return true, nil
 		}
 	}
 	return false, nil
 }
 
+// add 记录本次运行提交的任务。
+func (idx *undoneTaskIndex) add(srcFile, dstDir string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.own[buildTaskKey(srcFile, dstDir)] = struct{}{}
+}
+
+// invalidate 使下一次 has 重新拉取未完成任务列表。
+func (idx *undoneTaskIndex) invalidate() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remote = nil
+}
+
+// load 重新拉取未完成任务列表，调用方需持有 mu。
+func (idx *undoneTaskIndex) load(ctx context.Context) error {
+	tasks, err := idx.c.listUndoneCopyTasks(ctx)
+	if err != nil {
+		if !IsPermissionDenied(err) {
+			return err
+		}
+		// 非管理员用户可能无权查看任务列表，此时只按本次提交的任务去重。
+		if idx.remote == nil {
+			idx.c.logger.Info("no permission to list copy tasks, duplicate check limited to this run", F("error", err))
+		}
+		tasks = nil
+	}
+	remote := make(map[string]struct{}, len(tasks))
+	for _, t := range tasks {
+		if key, ok := parseCopyTaskKey(t.Name); ok {
+			remote[key] = struct{}{}
+		}
+	}
+	idx.remote = remote
+	idx.fetchedAt = time.Now()
+	idx.c.logger.Debug("undone copy tasks loaded", F("tasks", len(remote)))
+	return nil
+}
+
 // buildWantTaskKeys 构造待匹配任务 key：
 // 1) 用户视角路径（配置里的 src/dst）
 // 2) root 视角路径（拼上当前用户 base_path）
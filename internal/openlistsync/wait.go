@@ -0,0 +1,449 @@
+package openlistsync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OpenList 任务状态，取值与 OpenList 的 tache.State 一致。
+const (
+	taskStatePending      = 0
+	taskStateRunning      = 1
+	taskStateSucceeded    = 2
+	taskStateCanceling    = 3
+	taskStateCanceled     = 4
+	taskStateErrored      = 5
+	taskStateFailing      = 6
+	taskStateFailed       = 7
+	taskStateWaitingRetry = 8
+	taskStateBeforeRetry  = 9
+)
+
+// taskOutcome 为被跟踪任务的最终结果。
+type taskOutcome int
+
+const (
+	taskOutcomeRunning taskOutcome = iota
+	taskOutcomeSucceeded
+	taskOutcomeFailed
+	taskOutcomeCanceled
+	// taskOutcomeLost 表示任务已从 OpenList 的任务列表中消失，无法得知结果。
+	taskOutcomeLost
+)
+
+// lostAfterPolls 为任务连续多少次轮询都不在任务列表中时判定为丢失。
+const lostAfterPolls = 3
+
+// trackedTask 为本次运行提交、需要等待结果的复制任务。
+type trackedTask struct {
+	SrcFile  string
+	DstDir   string
+	ID       string
+	Outcome  taskOutcome
+	Progress float64
+	Error    string
+	// Retries 为已提交的重试次数。
+	Retries int
+	missing int
+	// retryAt 非零表示任务失败后等待在该时间点重试。
+	retryAt time.Time
+	// retried 与 failedEnd 用于识别重试后仍留在已完成列表中的旧失败记录。
+	retried   bool
+	failedEnd *time.Time
+}
+
+// waitSummary 为等待结束时的任务统计。
+type waitSummary struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	Canceled  int
+	Lost      int
+	Running   int
+	Retried   int
+	// Failures 为失败、取消或丢失的任务。
+	Failures []trackedTask
+}
+
+func (s waitSummary) unsuccessful() int {
+	return s.Failed + s.Canceled + s.Lost + s.Running
+}
+
+// taskTracker 跟踪本次运行提交的复制任务，直到它们出现在已完成列表中。
+// 优先按提交接口返回的任务 ID 匹配；OpenList 未返回 ID 时，
+// 按任务名解析出的 key 匹配提交前不存在的任务。
+type taskTracker struct {
+	c            *apiClient
+	userBasePath string
+	// maxRetries 为失败任务的最多重试次数，0 表示不重试；backoff 为首次重试前的等待时间，之后每次翻倍。
+	maxRetries int
+	backoff    time.Duration
+
+	mu      sync.Mutex
+	tasks   []*trackedTask
+	byID    map[string]*trackedTask
+	preseen map[string]struct{}
+}
+
+func newTaskTracker(c *apiClient, userBasePath string) *taskTracker {
+	return &taskTracker{
+		c:            c,
+		userBasePath: userBasePath,
+		byID:         make(map[string]*trackedTask),
+		preseen:      make(map[string]struct{}),
+	}
+}
+
+// snapshotExisting 记录提交前已存在的任务 ID，避免把历史任务误认为本次提交的任务。
+func (t *taskTracker) snapshotExisting(ctx context.Context) error {
+	undone, err := t.c.listUndoneCopyTasks(ctx)
+	if err != nil {
+		return err
+	}
+	done, err := t.c.listDoneCopyTasks(ctx)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, info := range append(undone, done...) {
+		if info.ID != "" {
+			t.preseen[info.ID] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// track 登记一个已提交的文件；infos 为提交接口返回的任务（可能为空）。
+func (t *taskTracker) track(srcFile, dstDir string, infos []taskInfo) {
+	if t == nil {
+		return
+	}
+	task := &trackedTask{SrcFile: srcFile, DstDir: dstDir}
+	wantKeys := buildWantTaskKeys(srcFile, dstDir, t.userBasePath)
+	for _, info := range infos {
+		key, ok := parseCopyTaskKey(info.Name)
+		if !ok || info.ID == "" {
+			continue
+		}
+		if _, ok := wantKeys[key]; ok {
+			task.ID = info.ID
+			break
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tasks = append(t.tasks, task)
+	if task.ID != "" {
+		t.byID[task.ID] = task
+	}
+}
+
+func (t *taskTracker) count() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.tasks)
+}
+
+// poll 拉取一次未完成和已完成任务列表并更新被跟踪任务的状态，返回是否全部结束。
+func (t *taskTracker) poll(ctx context.Context) (bool, error) {
+	undone, err := t.c.listUndoneCopyTasks(ctx)
+	if err != nil {
+		return false, err
+	}
+	done, err := t.c.listDoneCopyTasks(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bindByKey(undone, done)
+
+	seen := make(map[*trackedTask]struct{})
+	for _, info := range undone {
+		if task := t.byID[info.ID]; task != nil && task.Outcome == taskOutcomeRunning {
+			task.Progress = info.Progress
+			task.retried = false
+			seen[task] = struct{}{}
+		}
+	}
+	for _, info := range done {
+		task := t.byID[info.ID]
+		if task == nil || task.Outcome != taskOutcomeRunning {
+			continue
+		}
+		seen[task] = struct{}{}
+		outcome := outcomeOfState(info.State)
+		if outcome == taskOutcomeFailed && t.canRetry(task) {
+			if !task.retryAt.IsZero() || task.isStaleFailure(info) {
+				continue
+			}
+			task.Error = info.Error
+			task.failedEnd = info.EndTime
+			task.retryAt = time.Now().Add(t.backoffFor(task.Retries + 1))
+			continue
+		}
+		task.Progress = info.Progress
+		task.Error = info.Error
+		task.Outcome = outcome
+	}
+
+	finished := true
+	for _, task := range t.tasks {
+		if task.Outcome != taskOutcomeRunning {
+			continue
+		}
+		if _, ok := seen[task]; ok {
+			task.missing = 0
+		} else {
+			task.missing++
+			if task.missing >= lostAfterPolls {
+				task.Outcome = taskOutcomeLost
+				if task.Error == "" {
+					task.Error = "task not found in OpenList task lists"
+				}
+				continue
+			}
+		}
+		finished = false
+	}
+	return finished, nil
+}
+
+// bindByKey 为尚未拿到 ID 的任务按 key 绑定新出现的任务，调用方需持有 mu。
+func (t *taskTracker) bindByKey(lists ...[]taskInfo) {
+	unbound := make(map[string][]*trackedTask)
+	for _, task := range t.tasks {
+		if task.ID != "" {
+			continue
+		}
+		for key := range buildWantTaskKeys(task.SrcFile, task.DstDir, t.userBasePath) {
+			unbound[key] = append(unbound[key], task)
+		}
+	}
+	if len(unbound) == 0 {
+		return
+	}
+	for _, list := range lists {
+		for _, info := range list {
+			if info.ID == "" {
+				continue
+			}
+			if _, ok := t.preseen[info.ID]; ok {
+				continue
+			}
+			if _, ok := t.byID[info.ID]; ok {
+				continue
+			}
+			key, ok := parseCopyTaskKey(info.Name)
+			if !ok {
+				continue
+			}
+			for _, task := range unbound[key] {
+				if task.ID == "" {
+					task.ID = info.ID
+					t.byID[info.ID] = task
+					break
+				}
+			}
+		}
+	}
+}
+
+func (t *taskTracker) canRetry(task *trackedTask) bool {
+	return task.ID != "" && task.Retries < t.maxRetries
+}
+
+// backoffFor 返回第 n 次重试前的等待时间：backoff * 2^(n-1)。
+func (t *taskTracker) backoffFor(n int) time.Duration {
+	d := t.backoff
+	for i := 1; i < n && d < time.Hour; i++ {
+		d *= 2
+	}
+	return d
+}
+
+// isStaleFailure 判断已完成列表中的失败记录是否为重试前的那一次。
+func (task *trackedTask) isStaleFailure(info taskInfo) bool {
+	return task.retried && task.failedEnd != nil && info.EndTime != nil && info.EndTime.Equal(*task.failedEnd)
+}
+
+// retryDue 对到达重试时间的失败任务调用 OpenList 的任务重试接口。
+func (t *taskTracker) retryDue(ctx context.Context, logger *Logger) {
+	t.mu.Lock()
+	var due []*trackedTask
+	now := time.Now()
+	for _, task := range t.tasks {
+		if task.Outcome == taskOutcomeRunning && !task.retryAt.IsZero() && !now.Before(task.retryAt) {
+			due = append(due, task)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, task := range due {
+		err := t.c.retryCopyTask(ctx, task.ID)
+
+		t.mu.Lock()
+		task.Retries++
+		task.retryAt = time.Time{}
+		if err != nil {
+			logger.Error("retry copy task failed", F("src", task.SrcFile), F("dst", task.DstDir), F("attempt", task.Retries), F("max_attempts", t.maxRetries), F("error", err))
+			if t.canRetry(task) {
+				task.retryAt = time.Now().Add(t.backoffFor(task.Retries + 1))
+			} else {
+				task.Outcome = taskOutcomeFailed
+			}
+		} else {
+			logger.Info("retry copy task", F("src", task.SrcFile), F("dst", task.DstDir), F("attempt", task.Retries), F("max_attempts", t.maxRetries), F("error", task.Error))
+			task.retried = true
+			task.missing = 0
+		}
+		t.mu.Unlock()
+	}
+}
+
+func outcomeOfState(state int) taskOutcome {
+	switch state {
+	case taskStateSucceeded:
+		return taskOutcomeSucceeded
+	case taskStateCanceled, taskStateCanceling:
+		return taskOutcomeCanceled
+	default:
+		return taskOutcomeFailed
+	}
+}
+
+func (t *taskTracker) summary() waitSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := waitSummary{Total: len(t.tasks)}
+	for _, task := range t.tasks {
+		if task.Retries > 0 {
+			s.Retried++
+		}
+		switch task.Outcome {
+		case taskOutcomeSucceeded:
+			s.Succeeded++
+			continue
+		case taskOutcomeFailed:
+			s.Failed++
+		case taskOutcomeCanceled:
+			s.Canceled++
+		case taskOutcomeLost:
+			s.Lost++
+		default:
+			s.Running++
+		}
+		s.Failures = append(s.Failures, *task)
+	}
+	sort.Slice(s.Failures, func(i, j int) bool {
+		return s.Failures[i].SrcFile < s.Failures[j].SrcFile
+	})
+	return s
+}
+
+// snapshot 返回所有被跟踪任务的副本。
+func (t *taskTracker) snapshot() []trackedTask {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]trackedTask, len(t.tasks))
+	for i, task := range t.tasks {
+		out[i] = *task
+	}
+	return out
+}
+
+// progress 返回未结束任务的数量与平均进度（百分比）。
+func (t *taskTracker) progress() (int, float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	running := 0
+	var sum float64
+	for _, task := range t.tasks {
+		if task.Outcome == taskOutcomeRunning {
+			running++
+			sum += task.Progress
+		}
+	}
+	if running == 0 {
+		return 0, 100
+	}
+	return running, sum / float64(running)
+}
+
+// waitTasks 轮询直到所有被跟踪任务结束、超时或 ctx 结束。
+func waitTasks(ctx context.Context, t *taskTracker, interval, timeout time.Duration, logger *Logger) waitSummary {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	total := t.count()
+	logger.Info("waiting for copy tasks", F("tasks", total))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		t.retryDue(ctx, logger)
+		finished, err := t.poll(ctx)
+		if err != nil {
+			logger.Error("poll copy tasks failed", F("error", err))
+		} else {
+			running, avg := t.progress()
+			logger.Info("copy tasks progress", F("finished", total-running), F("total", total), F("running", running), F("avg_progress", fmt.Sprintf("%.1f%%", avg)))
+			if finished {
+				break
+			}
+		}
+		select {
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+			logger.Error("stop waiting for copy tasks", F("error", ctx.Err()))
+		}
+		break
+	}
+
+	s := t.summary()
+	for _, task := range s.Failures {
+		logger.Error("copy task "+outcomeLabel(task.Outcome), F("src", task.SrcFile), F("dst", task.DstDir), F("error", task.Error))
+	}
+	logger.Info("copy tasks finished", F("succeeded", s.Succeeded), F("failed", s.Failed), F("canceled", s.Canceled), F("lost", s.Lost), F("unfinished", s.Running), F("retried", s.Retried))
+	if len(s.Failures) > 0 && t.maxRetries > 0 {
+		logger.Error("files could not be copied after retries", F("files", len(s.Failures)), F("max_retries", t.maxRetries))
+		for _, task := range s.Failures {
+			logger.Error("not copied", F("src", task.SrcFile), F("dst", task.DstDir))
+		}
+	}
+	return s
+}
+
+func outcomeLabel(o taskOutcome) string {
+	switch o {
+	case taskOutcomeSucceeded:
+		return "succeeded"
+	case taskOutcomeFailed:
+		return "failed"
+	case taskOutcomeCanceled:
+		return "canceled"
+	case taskOutcomeLost:
+		return "lost"
+	default:
+		return "unfinished"
+	}
+}
+
+func (s waitSummary) err() error {
+	if n := s.unsuccessful(); n > 0 {
+		return fmt.Errorf("%d of %d copy task(s) did not succeed", n, s.Total)
+	}
+	return nil
+}
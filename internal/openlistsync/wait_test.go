@@ -0,0 +1,141 @@
+package openlistsync
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitTasksReportsOutcomes(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	var mu sync.Mutex
+	undone := []taskInfo{
+		{ID: "t1", Name: "copy [/src](a.txt) to [/dst](/)", State: taskStateRunning, Progress: 50},
+		{ID: "t2", Name: "copy [/src](b.txt) to [/dst](/)", State: taskStateRunning, Progress: 10},
+	}
+	done := []taskInfo{
+		{ID: "old", Name: "copy [/src](b.txt) to [/dst](/)", State: taskStateSucceeded},
+	}
+	f.handle("/api/task/copy/undone", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		writeAPIResp(w, 200, "success", undone)
+	})
+	f.handle("/api/task/copy/done", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		writeAPIResp(w, 200, "success", done)
+	})
+
+	tr := newTaskTracker(f.client(), "/")
+	if err := tr.snapshotExisting(context.Background()); err != nil {
+		t.Fatalf("snapshotExisting error: %v", err)
+	}
+	mu.Lock()
+	undone = nil
+	done = append(done,
+		taskInfo{ID: "t1", Name: "copy [/src](a.txt) to [/dst](/)", State: taskStateSucceeded, Progress: 100},
+		taskInfo{ID: "t2", Name: "copy [/src](b.txt) to [/dst](/)", State: taskStateFailed, Error: "upload failed"},
+		taskInfo{ID: "t3", Name: "copy [/src](c.txt) to [/dst](/)", State: taskStateCanceled},
+	)
+	mu.Unlock()
+
+	tr.track("/src/a.txt", "/dst", []taskInfo{{ID: "t1", Name: "copy [/src](a.txt) to [/dst](/)"}})
+	tr.track("/src/b.txt", "/dst", nil)
+	tr.track("/src/c.txt", "/dst", nil)
+
+	// a.txt 由提交接口返回的 ID 直接绑定；b.txt 没有 ID，且同名任务 t2 在提交前已存在，
+	// 不应被按名称绑定，最终判定为丢失；c.txt 按名称绑定到新任务 t3。
+	s := waitTasks(context.Background(), tr, time.Millisecond, time.Second, nil)
+	if s.Total != 3 || s.Succeeded != 1 || s.Canceled != 1 {
+		t.Fatalf("summary = %+v, want total=3 succeeded=1 canceled=1", s)
+	}
+	if s.Lost != 1 || s.Failures[0].SrcFile != "/src/b.txt" {
+		t.Fatalf("summary = %+v, want b.txt lost because t2 existed before submission", s)
+	}
+	if s.err() == nil {
+		t.Fatalf("expected error for unsuccessful tasks")
+	}
+}
+
+func TestWaitTasksFailedWithError(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	f.handle("/api/task/copy/done", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIResp(w, 200, "success", []taskInfo{
+			{ID: "t9", Name: "copy [/src](a.txt) to [/dst](/)", State: taskStateFailed, Error: "quota exceeded"},
+		})
+	})
+
+	tr := newTaskTracker(f.client(), "/")
+	tr.track("/src/a.txt", "/dst", []taskInfo{{ID: "t9", Name: "copy [/src](a.txt) to [/dst](/)"}})
+	s := waitTasks(context.Background(), tr, time.Millisecond, time.Second, nil)
+	if s.Failed != 1 || s.Failures[0].Error != "quota exceeded" {
+		t.Fatalf("summary = %+v, want one failure with error", s)
+	}
+}
+
+func TestWaitTasksRetryFailed(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	var mu sync.Mutex
+	end := time.Date(2026, 3, 3, 10, 0, 0, 0, time.UTC)
+	state := taskStateFailed
+	f.handle("/api/task/copy/done", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		writeAPIResp(w, 200, "success", []taskInfo{
+			{ID: "t1", Name: "copy [/src](a.txt) to [/dst](/)", State: state, Error: "network reset", EndTime: &end},
+		})
+	})
+	f.handle("/api/task/copy/retry", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("tid") != "t1" {
+			t.Errorf("retry tid = %q, want t1", r.URL.Query().Get("tid"))
+		}
+		mu.Lock()
+		state = taskStateSucceeded
+		end = end.Add(time.Minute)
+		mu.Unlock()
+		writeAPIResp(w, 200, "success", nil)
+	})
+
+	tr := newTaskTracker(f.client(), "/")
+	tr.maxRetries = 3
+	tr.backoff = time.Millisecond
+	tr.track("/src/a.txt", "/dst", []taskInfo{{ID: "t1", Name: "copy [/src](a.txt) to [/dst](/)"}})
+	s := waitTasks(context.Background(), tr, time.Millisecond, time.Second, nil)
+	if s.Succeeded != 1 || s.Retried != 1 || s.err() != nil {
+		t.Fatalf("summary = %+v, want succeeded after one retry", s)
+	}
+	if n := f.callCount("/api/task/copy/retry"); n != 1 {
+		t.Fatalf("retry calls = %d, want 1", n)
+	}
+}
+
+func TestWaitTasksRetryExhausted(t *testing.T) {
+	f := newFakeOpenList(t, nil)
+	var mu sync.Mutex
+	end := time.Date(2026, 3, 3, 10, 0, 0, 0, time.UTC)
+	f.handle("/api/task/copy/done", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		writeAPIResp(w, 200, "success", []taskInfo{
+			{ID: "t1", Name: "copy [/src](a.txt) to [/dst](/)", State: taskStateFailed, Error: "still broken", EndTime: &end},
+		})
+	})
+	f.handle("/api/task/copy/retry", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		end = end.Add(time.Minute)
+		mu.Unlock()
+		writeAPIResp(w, 200, "success", nil)
+	})
+
+	tr := newTaskTracker(f.client(), "/")
+	tr.maxRetries = 2
+	tr.backoff = time.Millisecond
+	tr.track("/src/a.txt", "/dst", []taskInfo{{ID: "t1", Name: "copy [/src](a.txt) to [/dst](/)"}})
+	s := waitTasks(context.Background(), tr, time.Millisecond, time.Second, nil)
+	if s.Failed != 1 || s.Failures[0].Retries != 2 || s.Failures[0].Error != "still broken" {
+		t.Fatalf("summary = %+v, want failure after 2 retries", s)
+	}
+}